@@ -17,13 +17,19 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/ci4rail/velog/cmd/logger/internal/can"
 	"github.com/ci4rail/velog/cmd/logger/internal/ctx"
 	"github.com/ci4rail/velog/cmd/logger/internal/mvb"
+	"github.com/ci4rail/velog/cmd/logger/internal/output"
+	"github.com/ci4rail/velog/cmd/logger/internal/session"
+	"github.com/ci4rail/velog/internal/version"
+	"github.com/ci4rail/velog/pkg/csvlogger"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -32,6 +38,14 @@ import (
 
 type globalConfiguration struct {
 	LoggerOutputDir string
+	VehicleID       string // value of the {vehicle} file name placeholder
+	Sessions        bool   // create a session directory for each start
+	Retention       retentionConfiguration
+}
+
+type retentionConfiguration struct {
+	MinFreeSpace int64 // free space in bytes to keep on the disk, 0 means no limit
+	MaxTotalSize int64 // maximum total size in bytes of all log files, 0 means no limit
 }
 
 var (
@@ -63,11 +77,49 @@ func run(cmd *cobra.Command, args []string) {
 		log.Fatal().Msgf("create logger output dir %s", err)
 	}
 
+	// finalise files left over from an unclean shutdown
+	err = csvlogger.Recover(globalCfg.LoggerOutputDir)
+	if err != nil {
+		log.Error().Msgf("recover logger output dir %s", err)
+	}
+
+	// configure retention
+	var retention *csvlogger.Retention
+	if globalCfg.Retention.MinFreeSpace > 0 || globalCfg.Retention.MaxTotalSize > 0 {
+		retention = csvlogger.NewRetention(globalCfg.LoggerOutputDir, globalCfg.Retention.MinFreeSpace, globalCfg.Retention.MaxTotalSize)
+		go runRetention(ctx, retention)
+	}
+
+	// background compression of closed files
+	compressor := csvlogger.NewCompressor()
+	compressor.Retention = retention
+	go runCompressor(ctx, compressor)
+
+	out := &output.Config{
+		Dir:        globalCfg.LoggerOutputDir,
+		BaseDir:    globalCfg.LoggerOutputDir,
+		VehicleID:  globalCfg.VehicleID,
+		Retention:  retention,
+		Compressor: compressor,
+	}
+
+	// create session directory
+	var sess *session.Session
+	if globalCfg.Sessions {
+		sess, err = session.New(globalCfg.LoggerOutputDir, version.Version, viper.AllSettings())
+		if err != nil {
+			log.Fatal().Msgf("create session %s", err)
+		}
+		log.Info().Msgf("Session directory %s", sess.Dir)
+		out.Dir = sess.Dir
+		out.Session = sess
+	}
+
 	// configure loggers
 	var mvbLogger *mvb.Logger
 	mvbConfig := viper.Sub("mvb")
 	if mvbConfig != nil {
-		mvbLogger, err = mvb.NewFromViper(ctx, mvbConfig, globalCfg.LoggerOutputDir)
+		mvbLogger, err = mvb.NewFromViper(ctx, mvbConfig, out)
 		if err != nil {
 			log.Fatal().Msgf("mvbLogger: %s", err)
 		}
@@ -75,7 +127,7 @@ func run(cmd *cobra.Command, args []string) {
 	var canLogger *can.Logger
 	canConfig := viper.Sub("can")
 	if canConfig != nil {
-		canLogger, err = can.NewFromViper(ctx, canConfig, globalCfg.LoggerOutputDir)
+		canLogger, err = can.NewFromViper(ctx, canConfig, out)
 		if err != nil {
 			log.Fatal().Msgf("canLogger: %s", err)
 		}
@@ -102,9 +154,48 @@ func run(cmd *cobra.Command, args []string) {
 	log.Info().Msgf("Received signal %s", sig)
 	cancel()
 	wg.Wait()
+	if sess != nil {
+		if err := sess.Close(); err != nil {
+			log.Error().Msgf("close session %s", err)
+		}
+	}
 	log.Info().Msgf("Exit Program")
 }
 
+// runRetention periodically deletes the oldest log files to keep the configured reserve
+func runRetention(c context.Context, retention *csvlogger.Retention) {
+	wg, err := ctx.WgFromContext(c)
+	if err != nil {
+		log.Error().Msg(err.Error())
+		return
+	}
+	defer wg.Done()
+
+	for {
+		_, err := retention.Enforce()
+		if err != nil {
+			log.Error().Msgf("retention: %s", err)
+		}
+		select {
+		case <-c.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// runCompressor compresses closed log files in the background
+func runCompressor(c context.Context, compressor *csvlogger.Compressor) {
+	wg, err := ctx.WgFromContext(c)
+	if err != nil {
+		log.Error().Msg(err.Error())
+		return
+	}
+	defer wg.Done()
+
+	compressor.Run(c)
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/ci4rail/io4edge-client-go/canl2"
@@ -41,20 +42,23 @@ func (l *Logger) Run() error {
 		return fmt.Errorf("error starting can sniffer stream: %s", err)
 	}
 
-	csvLogger := csvlogger.NewWriter(l.outputDir, l.cfg.FileName)
-	writeCsvHeader(csvLogger)
+	csvLogger, err := l.out.NewFileWriter(l.cfg.FileName, "can", &l.cfg.Files, l.cfg.SnifferDevice, l.cfg)
+	if err != nil {
+		return err
+	}
+	asyncLogger := csvlogger.NewAsyncWriter(csvLogger, l.cfg.QueueSize, l.handleWriteError)
+	l.writeCsvHeader(asyncLogger)
 
-	// go routine to read the stream and write it to the csv file
+	// go routine to read the stream and pass it to the csv writer
 	go func() {
 		l.logger.Info().Msg("Start logging CAN data")
-		defer csvLogger.Close()
-
 		wg, err := ctx.WgFromContext(l.ctx)
 		if err != nil {
 			l.logger.Error().Msg(err.Error())
 			return
 		}
 		defer wg.Done()
+		defer asyncLogger.Close()
 
 		for {
 			select {
@@ -65,12 +69,16 @@ func (l *Logger) Run() error {
 			}
 			sd, err := c.ReadStream(time.Second * 2)
 			if err == nil {
+				received := time.Now()
 				samples := sd.FSData.Samples
 				//l.logger.Info().Msgf("Read CAN sniffer stream: %d", len(samples))
 
 				for _, sample := range samples {
+					if l.clock.Observe(int64(sample.Timestamp), received) {
+						l.logger.Warn().Msg("CAN sniffer restart detected, UTC correlation restarted")
+					}
 					if sample.IsDataFrame {
-						err := l.Write(sample, csvLogger)
+						err := l.Write(sample, asyncLogger)
 						if err != nil {
 							return
 						}
@@ -118,22 +126,39 @@ func (l *Logger) Run() error {
 	go func() {
 		for {
 			time.Sleep(5 * time.Second)
-			l.logger.Info().Msgf("Number of lines written to all csv files: %d", l.lineCount)
+			l.logger.Info().Msgf("Number of lines written to all csv files: %d", atomic.LoadInt64(&l.lineCount))
+			stats := asyncLogger.WriterStats()
+			l.logger.Info().Msgf("Write latency: %s, flush latency: %s, sync latency: %s", stats.Writes, stats.Flushes, stats.Syncs)
+			queueStats := asyncLogger.Stats()
+			l.logger.Info().Msgf("Queue high water mark: %d/%d, dropped records: %d", queueStats.QueueHighWater, queueStats.QueueSize, queueStats.Dropped)
 		}
 	}()
 	return nil
 }
 
-func (l *Logger) Write(s *canpb.Sample, csvLogger *csvlogger.Writer) error {
+// Write passes the CAN sample to the csv writer.
+// An error is returned if recording must stop.
+func (l *Logger) Write(s *canpb.Sample, csvLogger csvlogger.RecordWriter) error {
 	err := l.writeCsvEntry(csvLogger, s)
 
+	var queueFull *csvlogger.QueueFull
+	if errors.As(err, &queueFull) {
+		// the sample is dropped, the AsyncWriter counts the dropped samples
+		return nil
+	}
+	return err
+}
+
+// handleWriteError is called from the writer goroutine of the AsyncWriter when writing record failed
+func (l *Logger) handleWriteError(csvLogger *csvlogger.Writer, record []string, err error) error {
 	var fileSizeLimitReached *csvlogger.FileSizeLimitReached
+	var rotationTimeReached *csvlogger.RotationTimeReached
 	var diskFull *csvlogger.DiskFull
 
-	if errors.As(err, &fileSizeLimitReached) {
+	if errors.As(err, &fileSizeLimitReached) || errors.As(err, &rotationTimeReached) {
 		// a new file was created, write the header and the last entry again
-		writeCsvHeader(csvLogger)
-		err := l.writeCsvEntry(csvLogger, s)
+		l.writeCsvHeader(csvLogger)
+		err := csvLogger.Write(record)
 
 		if err != nil {
 			l.logger.Error().Msgf("Error writing csv entry: %s", err)
@@ -147,18 +172,22 @@ func (l *Logger) Write(s *canpb.Sample, csvLogger *csvlogger.Writer) error {
 	return nil
 }
 
-func writeCsvHeader(csvLogger *csvlogger.Writer) {
-	csvLogger.Write([]string{
-		"TimeSinceStart (us)",
+func (l *Logger) writeCsvHeader(csvLogger csvlogger.RecordWriter) {
+	header := []string{"TimeSinceStart (us)"}
+	if l.cfg.UTCColumn {
+		header = append(header, "UTC")
+	}
+	header = append(header,
 		"ID (hex)",
 		"Data (hex)",
 		"Ext",
 		"RTR",
 		time.Now().Format("2006-01-02 15:04:05"),
-	})
+	)
+	csvLogger.Write(header)
 }
 
-func (l *Logger) writeCsvEntry(csvLogger *csvlogger.Writer, s *canpb.Sample) error {
+func (l *Logger) writeCsvEntry(csvLogger csvlogger.RecordWriter, s *canpb.Sample) error {
 	rtr := ""
 	if s.Frame.RemoteFrame {
 		rtr = "R"
@@ -167,16 +196,20 @@ func (l *Logger) writeCsvEntry(csvLogger *csvlogger.Writer, s *canpb.Sample) err
 	if s.Frame.ExtendedFrameFormat {
 		ext = "X"
 	}
-	err := csvLogger.Write([]string{
-		fmt.Sprintf("%d", s.Timestamp),
+	record := []string{fmt.Sprintf("%d", s.Timestamp)}
+	if l.cfg.UTCColumn {
+		record = append(record, l.clock.FormatUTC(int64(s.Timestamp)))
+	}
+	record = append(record,
 		fmt.Sprintf("%x", s.Frame.MessageId),
 		hex.EncodeToString(s.Frame.Data),
 		ext,
 		rtr,
-	})
+	)
+	err := csvLogger.WriteWithTimestamp(record, int64(s.Timestamp))
 	if err != nil {
 		return err
 	}
-	l.lineCount++
+	atomic.AddInt64(&l.lineCount, 1)
 	return nil
 }
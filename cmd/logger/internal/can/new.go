@@ -4,47 +4,56 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/ci4rail/velog/cmd/logger/internal/output"
+	"github.com/ci4rail/velog/pkg/clockcorrelation"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
+const defaultQueueSize = 10000
+
 type configuration struct {
-	SnifferDevice  string  // e.g. "S101-IOU03-USB-EXT-1-can"
-	FileName       string  // prefix for log files e.g. "can"
-	Bitrate        int     // e.g. 500000
-	SamplePoint    float32 // e.g. 0.8
-	SJW            int     // e.g. 1
-	AcceptanceMask uint32  // e.g. 0x000
-	AcceptanceCode uint32  // e.g. 0x7FF
+	SnifferDevice  string                   // e.g. "S101-IOU03-USB-EXT-1-can"
+	FileName       string                   // prefix or template for log files e.g. "can" or "{vehicle}_{bus}_{date}_{index}.csv"
+	Bitrate        int                      // e.g. 500000
+	SamplePoint    float32                  // e.g. 0.8
+	SJW            int                      // e.g. 1
+	AcceptanceMask uint32                   // e.g. 0x000
+	AcceptanceCode uint32                   // e.g. 0x7FF
+	QueueSize      int                      // number of records that can be queued for writing, default 10000
+	UTCColumn      bool                     // add a column with the UTC time of the device timestamp in ISO-8601 format
+	output.Files   `mapstructure:",squash"` // file limits, rotation, compression, durability and manifest
 }
 
 // Logger is the instance of the CAN logger
 type Logger struct {
 	cfg       *configuration
-	outputDir string
+	out       *output.Config
 	logger    zerolog.Logger
 	ctx       context.Context
-	lineCount int
+	clock     *clockcorrelation.Correlator // maps device timestamps to UTC
+	lineCount int64                        // accessed atomically
 }
 
 // NewFromViper creates a new CAN Unit from a viper configuration
-func NewFromViper(ctx context.Context, viperCfg *viper.Viper, outputDir string) (*Logger, error) {
+func NewFromViper(ctx context.Context, viperCfg *viper.Viper, out *output.Config) (*Logger, error) {
 	cfg, err := readConfig(viperCfg)
 	if err != nil {
 		return nil, err
 	}
-	return New(ctx, cfg, outputDir), nil
+	return New(ctx, cfg, out), nil
 }
 
 // New creates a new instance of CAN Unit
-func New(ctx context.Context, cfg *configuration, outputDir string) *Logger {
+func New(ctx context.Context, cfg *configuration, out *output.Config) *Logger {
 
 	l := &Logger{
 		cfg:       cfg,
-		outputDir: outputDir,
+		out:       out,
 		logger:    log.With().Str("component", "CAN").Logger(),
 		ctx:       ctx,
+		clock:     clockcorrelation.New(),
 		lineCount: 0,
 	}
 
@@ -62,6 +71,11 @@ func readConfig(sub *viper.Viper) (*configuration, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal config %s", err)
 	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = defaultQueueSize
+	} else if cfg.QueueSize < 0 {
+		return nil, fmt.Errorf("invalid queue size %d", cfg.QueueSize)
+	}
 
 	return &cfg, nil
 }
@@ -0,0 +1,71 @@
+package mvb
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ci4rail/velog/pkg/processdatastore"
+)
+
+type changeFilterConfiguration struct {
+	Address   uint32                  // MVB port address
+	Mask      string                  // hex mask of the bits to compare, e.g. "fff0", missing bytes are compared completely
+	Deadbands []deadbandConfiguration // numeric values that must change by more than their deadband
+}
+
+type deadbandConfiguration struct {
+	Offset   int     // byte offset of the value in the port data
+	Type     string  // UNSIGNED8, UNSIGNED16, UNSIGNED32, INTEGER8, INTEGER16 or INTEGER32
+	Deadband float64 // in raw units
+}
+
+// deadbandTypes maps the MVB data types to their size in bytes and signedness
+var deadbandTypes = map[string]struct {
+	size   int
+	signed bool
+}{
+	"UNSIGNED8":  {1, false},
+	"UNSIGNED16": {2, false},
+	"UNSIGNED32": {4, false},
+	"INTEGER8":   {1, true},
+	"INTEGER16":  {2, true},
+	"INTEGER32":  {4, true},
+}
+
+// changeFilter converts the configuration to a process data store change filter
+func (c *changeFilterConfiguration) changeFilter() (*processdatastore.ChangeFilter, error) {
+	mask, err := hex.DecodeString(c.Mask)
+	if err != nil {
+		return nil, fmt.Errorf("address %x: invalid mask %q: %s", c.Address, c.Mask, err)
+	}
+	f := &processdatastore.ChangeFilter{Mask: mask}
+	for _, dc := range c.Deadbands {
+		t, ok := deadbandTypes[dc.Type]
+		if !ok {
+			return nil, fmt.Errorf("address %x: invalid deadband type %q", c.Address, dc.Type)
+		}
+		d := processdatastore.Deadband{
+			Offset:   dc.Offset,
+			Size:     t.size,
+			Signed:   t.signed,
+			Deadband: dc.Deadband,
+		}
+		if err := d.Validate(); err != nil {
+			return nil, fmt.Errorf("address %x: %s", c.Address, err)
+		}
+		f.Deadbands = append(f.Deadbands, d)
+	}
+	return f, nil
+}
+
+// setChangeFilters applies the configured change filters to the store
+func (l *Logger) setChangeFilters(s processdatastore.ObjectStore) error {
+	for _, c := range l.cfg.ChangeFilters {
+		f, err := c.changeFilter()
+		if err != nil {
+			return err
+		}
+		s.SetChangeFilter(c.Address, f)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package mvb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	mvbpb "github.com/ci4rail/io4edge_api/mvbSniffer/go/mvbSniffer/v1"
+	"github.com/ci4rail/velog/pkg/clockcorrelation"
+	"github.com/ci4rail/velog/pkg/csvlogger"
+	"github.com/ci4rail/velog/pkg/mvbframe"
+)
+
+const defaultInventoryFileName = "mvbinv"
+
+// inventoryRefreshInterval is the interval to write the session manifest even without inventory changes, to update the last seen times
+const inventoryRefreshInterval = time.Minute
+
+// inventoryFilter receives the device status frames, if no filters are configured
+var inventoryFilter = filterConfiguration{
+	FCodes: []int{15},
+}
+
+type inventoryConfiguration struct {
+	Enable   bool   // collect the devices that answer device status requests (F-code 15)
+	FileName string // prefix or template for inventory files, default "mvbinv". The {bus} placeholder is "mvbinv".
+}
+
+// newInventoryLogger creates the device inventory and the writer for the inventory csv files.
+// If sessions are enabled, the inventory is added to the session manifest.
+func (l *Logger) newInventoryLogger() (*csvlogger.AsyncWriter, error) {
+	fileName := l.cfg.Inventory.FileName
+	if fileName == "" {
+		fileName = defaultInventoryFileName
+	}
+	csvLogger, err := l.newCsvWriter(fileName, "mvbinv")
+	if err != nil {
+		return nil, err
+	}
+	l.inventory = mvbframe.NewInventory()
+	if l.out.Session != nil {
+		l.out.Session.AddSection("mvbInventory", func() interface{} { return l.inventory.Devices() })
+	}
+	invLogger := csvlogger.NewAsyncWriter(csvLogger, l.cfg.QueueSize, l.handleInventoryWriteError)
+	l.writeInventoryCsvHeader(invLogger)
+	return invLogger, nil
+}
+
+// logInventoryTelegram records the device status in the inventory and writes it to the inventory csv file,
+// if the device is new or its status has changed. Timed out device status requests are ignored.
+func (l *Logger) logInventoryTelegram(invLogger csvlogger.RecordWriter, telegram *mvbpb.Telegram, received time.Time) {
+	status, ok := mvbframe.ParseDeviceStatus(telegram.Data)
+	if !ok {
+		return
+	}
+	seen, ok := l.clock.ToUTC(int64(telegram.Timestamp))
+	if !ok {
+		seen = received.UTC()
+	}
+	device, changed, isNew := l.inventory.Observe(uint16(telegram.Address&0xfff), status, seen)
+	if !changed {
+		return
+	}
+	event := "changed"
+	if isNew {
+		event = "new"
+		l.logger.Info().Msgf("MVB device %x found, status %s", device.Address, status)
+	}
+	atomic.StoreInt32(&l.inventoryChanged, 1)
+	// the AsyncWriter counts the dropped records, other errors have been logged by the write error handler
+	l.writeInventoryCsvEntry(invLogger, telegram, device, event)
+}
+
+// updateInventory writes the session manifest, if the inventory has changed since the last update or if refresh is set,
+// so that the last seen times in the manifest are current
+func (l *Logger) updateInventory(refresh bool) {
+	if l.out.Session == nil || !(atomic.CompareAndSwapInt32(&l.inventoryChanged, 1, 0) || refresh) {
+		return
+	}
+	if err := l.out.Session.Update(); err != nil {
+		l.logger.Error().Msgf("Error writing MVB inventory to session manifest: %s", err)
+	}
+}
+
+// handleInventoryWriteError is called from the writer goroutine of the AsyncWriter when writing record failed
+func (l *Logger) handleInventoryWriteError(csvLogger *csvlogger.Writer, record []string, err error) error {
+	var fileSizeLimitReached *csvlogger.FileSizeLimitReached
+	var rotationTimeReached *csvlogger.RotationTimeReached
+	var diskFull *csvlogger.DiskFull
+
+	if errors.As(err, &fileSizeLimitReached) || errors.As(err, &rotationTimeReached) {
+		// a new file was created, write the header and the last entry again
+		l.writeInventoryCsvHeader(csvLogger)
+		err := csvLogger.Write(record)
+
+		if err != nil {
+			l.logger.Error().Msgf("Error writing inventory csv entry: %s", err)
+		}
+	} else if errors.As(err, &diskFull) {
+		l.logger.Error().Msgf("Disk full when writing inventory csv entry: %s. Stop inventory recording", err)
+		return err
+	} else if err != nil {
+		l.logger.Error().Msgf("Error writing inventory csv entry: %s", err)
+	}
+	return nil
+}
+
+func (l *Logger) writeInventoryCsvHeader(csvLogger csvlogger.RecordWriter) {
+	header := []string{
+		"TimeSinceStart (us)",
+		"Seen (UTC)",
+		"Address (hex)",
+		"Event",
+		"Status (hex)",
+		"SP", "BA", "GW", "MD", "SER", "DNR", "FRC",
+		"Device Status",
+		time.Now().Format("2006-01-02 15:04:05"),
+	}
+	csvLogger.Write(header)
+}
+
+func (l *Logger) writeInventoryCsvEntry(csvLogger csvlogger.RecordWriter, telegram *mvbpb.Telegram, device mvbframe.Device, event string) error {
+	s := device.Status
+	record := []string{
+		strconv.FormatUint(telegram.Timestamp, 10),
+		device.LastSeen.Format(clockcorrelation.ISO8601),
+		fmt.Sprintf("%x", device.Address),
+		event,
+		fmt.Sprintf("%04x", uint16(s)),
+		bit(s.Has(mvbframe.SP)), bit(s.Has(mvbframe.BA)), bit(s.Has(mvbframe.GW)), bit(s.Has(mvbframe.MD)),
+		bit(s.Has(mvbframe.SER)), bit(s.Has(mvbframe.DNR)), bit(s.Has(mvbframe.FRC)),
+		s.String(),
+	}
+	err := csvLogger.WriteWithTimestamp(record, int64(telegram.Timestamp))
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&l.lineCount, 1)
+	return nil
+}
+
+// bit formats a flag as 0 or 1
+func bit(set bool) string {
+	if set {
+		return "1"
+	}
+	return "0"
+}
@@ -4,7 +4,10 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/ci4rail/io4edge-client-go/functionblock"
@@ -27,24 +30,69 @@ func (l *Logger) Run() error {
 		return fmt.Errorf("error creating mvb sniffer client: %s", err)
 	}
 	// start stream
-	err = c.StartStream(
-		mvbsniffer.WithFilterMask(mvbsniffer.FilterMask{
-			// receive any process data telegram, except timed out frames
-			FCodeMask:             0x001F,
-			Address:               0x0000,
-			Mask:                  0x0000,
-			IncludeTimedoutFrames: false,
-		}),
+	opts, err := l.filterOptions()
+	if err != nil {
+		return fmt.Errorf("error configuring mvb sniffer filter: %s", err)
+	}
+	opts = append(opts,
 		mvbsniffer.WithFBStreamOption(functionblock.WithBucketSamples(100)),
 		mvbsniffer.WithFBStreamOption(functionblock.WithBufferedSamples(200)),
 	)
+	err = c.StartStream(opts...)
 	if err != nil {
 		return fmt.Errorf("error starting mvb sniffer stream: %s", err)
 	}
 
-	s := processdatastore.NewStore()
-	csvLogger := csvlogger.NewWriter(l.outputDir, l.cfg.FileName)
-	writeCsvHeader(csvLogger)
+	s := processdatastore.NewFixedStore()
+	if err := l.setChangeFilters(s); err != nil {
+		return fmt.Errorf("error setting change filters: %s", err)
+	}
+	s.SetDefaultHistoryDepth(l.cfg.History.Depth)
+	for _, h := range l.cfg.History.Addresses {
+		s.SetHistoryDepth(h.Address, h.Depth)
+	}
+	s.SetDefaultStaleTimeout(l.cfg.Stale.Timeout)
+	for _, a := range l.cfg.Stale.Addresses {
+		s.SetStaleTimeout(a.Address, a.Timeout)
+	}
+	if l.cfg.CheckpointInterval > 0 {
+		l.restore(s)
+	}
+	l.store = s
+	csvLogger, err := l.newCsvWriter(l.cfg.FileName, "mvb")
+	if err != nil {
+		return err
+	}
+	asyncLogger := csvlogger.NewAsyncWriter(csvLogger, l.cfg.QueueSize, l.handleWriteError)
+	l.writeCsvHeader(asyncLogger)
+
+	var rawLogger *csvlogger.AsyncWriter
+	if l.cfg.Raw.Enable {
+		rawLogger, err = l.newRawLogger()
+		if err != nil {
+			return err
+		}
+	}
+	var supLogger *csvlogger.AsyncWriter
+	if l.cfg.Supervisory.Enable {
+		supLogger, err = l.newSupervisoryLogger()
+		if err != nil {
+			return err
+		}
+	}
+	if l.cfg.catalog != nil {
+		l.signalLogger, err = l.newSignalLogger()
+		if err != nil {
+			return err
+		}
+	}
+	var invLogger *csvlogger.AsyncWriter
+	if l.cfg.Inventory.Enable {
+		invLogger, err = l.newInventoryLogger()
+		if err != nil {
+			return err
+		}
+	}
 
 	// go routine to read the stream and write it to the process data store
 	go func() {
@@ -56,6 +104,15 @@ func (l *Logger) Run() error {
 			return
 		}
 		defer wg.Done()
+		if rawLogger != nil {
+			defer rawLogger.Close()
+		}
+		if supLogger != nil {
+			defer supLogger.Close()
+		}
+		if invLogger != nil {
+			defer invLogger.Close()
+		}
 
 		for {
 			select {
@@ -66,11 +123,15 @@ func (l *Logger) Run() error {
 			}
 			sd, err := c.ReadStream(time.Second * 2)
 			if err == nil {
+				received := time.Now()
 				telegramCollection := sd.FSData.GetEntry()
 				// l.logger.Info().Msgf("Read stream: %d", len(telegramCollection))
 
 				for _, telegram := range telegramCollection {
 
+					if l.clock.Observe(int64(telegram.Timestamp), received) {
+						l.logger.Warn().Msg("MVB sniffer restart detected, UTC correlation restarted")
+					}
 					if telegram.State != uint32(mvbpb.Telegram_kSuccessful) {
 						if telegram.State&uint32(mvbpb.Telegram_kMissedMVBFrames) != 0 {
 							l.logger.Warn().Msg("one or more MVB frames are lost in the device since the last telegram")
@@ -79,7 +140,23 @@ func (l *Logger) Run() error {
 							l.logger.Warn().Msg("one or more telegrams are lost")
 						}
 					}
-					l.logTelegram(s, telegram)
+					deviceStatus := telegram.Type == mvbpb.Telegram_kDeviceStatus
+					if invLogger != nil && deviceStatus {
+						l.logInventoryTelegram(invLogger, telegram, received)
+					}
+					switch {
+					case supLogger != nil && isSupervisory(telegram):
+						l.logSupervisoryTelegram(supLogger, telegram)
+					case invLogger != nil && deviceStatus:
+						// device status is only recorded in the inventory
+					case isProcessData(telegram):
+						l.logTelegram(s, telegram)
+					default:
+						// other F-codes, e.g. received due to the configured filters, are not process data
+					}
+					if rawLogger != nil {
+						l.logRawTelegram(rawLogger, telegram)
+					}
 				}
 			} else {
 				// firmware may be restarted... Let systemd restart the service
@@ -89,117 +166,337 @@ func (l *Logger) Run() error {
 	}()
 
 	// write the process data store periodically to the csv file
-	go l.storeToCsv(s, csvLogger)
+	go l.storeToCsv(s, asyncLogger)
 
 	// go routine to log the number of lines written to the csv file
 	go func() {
 		for {
 			time.Sleep(5 * time.Second)
-			l.logger.Info().Msgf("Number of lines written to all csv files: %d", l.lineCount)
+			l.logger.Info().Msgf("Number of lines written to all csv files: %d", atomic.LoadInt64(&l.lineCount))
+			stats := asyncLogger.WriterStats()
+			l.logger.Info().Msgf("Write latency: %s, flush latency: %s, sync latency: %s", stats.Writes, stats.Flushes, stats.Syncs)
+			queueStats := asyncLogger.Stats()
+			l.logger.Info().Msgf("Queue high water mark: %d/%d, dropped records: %d", queueStats.QueueHighWater, queueStats.QueueSize, queueStats.Dropped)
+			if rawLogger != nil {
+				queueStats := rawLogger.Stats()
+				l.logger.Info().Msgf("Raw queue high water mark: %d/%d, dropped records: %d", queueStats.QueueHighWater, queueStats.QueueSize, queueStats.Dropped)
+			}
+			if supLogger != nil {
+				queueStats := supLogger.Stats()
+				l.logger.Info().Msgf("Supervisory queue high water mark: %d/%d, dropped records: %d", queueStats.QueueHighWater, queueStats.QueueSize, queueStats.Dropped)
+			}
+			if l.signalLogger != nil {
+				queueStats := l.signalLogger.Stats()
+				l.logger.Info().Msgf("Signal queue high water mark: %d/%d, dropped records: %d", queueStats.QueueHighWater, queueStats.QueueSize, queueStats.Dropped)
+			}
+			if invLogger != nil {
+				queueStats := invLogger.Stats()
+				l.logger.Info().Msgf("Inventory queue high water mark: %d/%d, dropped records: %d", queueStats.QueueHighWater, queueStats.QueueSize, queueStats.Dropped)
+			}
 		}
 	}()
 
 	return nil
 }
 
-func (l *Logger) logTelegram(s *processdatastore.Store, telegram *mvbpb.Telegram) {
-	s.Write(newTelegramObject(telegram))
+// newCsvWriter creates a csv writer with the configured file limits, compression, durability and manifest
+func (l *Logger) newCsvWriter(fileName string, bus string) (*csvlogger.Writer, error) {
+	return l.out.NewFileWriter(fileName, bus, &l.cfg.Files, l.cfg.SnifferDevice, l.cfg)
 }
 
-func (l *Logger) storeToCsv(s *processdatastore.Store, csvLogger *csvlogger.Writer) {
-	defer csvLogger.Close()
+// isProcessData checks whether the telegram is a process data telegram, i.e. has one of the F-codes 0 to 4
+func isProcessData(telegram *mvbpb.Telegram) bool {
+	return telegram.Type <= mvbpb.Telegram_kProcessData256Bit
+}
+
+func (l *Logger) logTelegram(s processdatastore.ObjectStore, telegram *mvbpb.Telegram) {
+	// the FixedStore copies the telegram, so the object is reused to avoid an allocation per telegram
+	l.telegram.telegram = telegram
+	s.Write(&l.telegram)
+}
 
+func (l *Logger) storeToCsv(s processdatastore.ObjectStore, csvLogger *csvlogger.AsyncWriter) {
 	wg, err := ctx.WgFromContext(l.ctx)
 	if err != nil {
 		l.logger.Error().Msg(err.Error())
 		return
 	}
 	defer wg.Done()
+	defer csvLogger.Close()
+	if l.signalLogger != nil {
+		defer l.signalLogger.Close()
+	}
 
+	lastCheckpoint := time.Now()
+	lastInventoryRefresh := time.Now()
 	for {
 		time.Sleep(time.Duration(l.cfg.DumpInterval) * time.Millisecond)
 
 		select {
 		case <-l.ctx.Done():
 			l.logger.Info().Msg("Stop storing MVB data")
+			if l.cfg.CheckpointInterval > 0 {
+				l.checkpoint(s)
+			}
 			return
 		default:
 		}
 
-		err := l.DumpStore(s, csvLogger, false, 0)
+		// after a restore, the dump contains all entries, so that the first file is complete
+		dumpAll := l.dumpNumber == 0 && l.restored > 0
+		err := l.DumpStore(s, csvLogger, l.dumpNumber, dumpAll)
 		l.dumpNumber++
 
-		var diskFull *csvlogger.DiskFull
-		if errors.As(err, &diskFull) {
-			l.logger.Error().Msgf("Disk full when writing csv entry: %s. Stop recording", err)
+		if err != nil {
+			// recording stopped, the reason has been logged by the write error handler
 			return
 		}
+
+		if l.inventory != nil {
+			refresh := time.Since(lastInventoryRefresh) >= inventoryRefreshInterval
+			l.updateInventory(refresh)
+			if refresh {
+				lastInventoryRefresh = time.Now()
+			}
+		}
+		if l.cfg.CheckpointInterval > 0 && time.Since(lastCheckpoint) >= l.cfg.CheckpointInterval {
+			l.checkpoint(s)
+			lastCheckpoint = time.Now()
+		}
 	}
 }
 
-// DumpStore dumps the process data store to a csv file
-// If dumpAll is true, all entries are dumped, otherwise only the entries that have been updated since the last dump
-func (l *Logger) DumpStore(s *processdatastore.Store, csvLogger *csvlogger.Writer, dumpAll bool, recursionLevel int) error {
-	addresses := s.List()
-	for _, address := range addresses {
-		o, updates, err := s.Read(uint32(address))
-		if err == nil {
-			if dumpAll || (updates > 0) {
-				err := l.writeCsvEntry(csvLogger, o, updates)
+// checkpointName returns the name of the checkpoint file of the object dictionary.
+// It is in the base output directory, so that it is found again when sessions are enabled.
+func (l *Logger) checkpointName() string {
+	return filepath.Join(l.out.BaseDir, "mvb-checkpoint.json")
+}
 
-				var fileSizeLimitReached *csvlogger.FileSizeLimitReached
-				var diskFull *csvlogger.DiskFull
+// checkpoint saves the object dictionary
+func (l *Logger) checkpoint(s processdatastore.ObjectStore) {
+	if err := s.Checkpoint(l.checkpointName()); err != nil {
+		l.logger.Error().Msgf("Error saving MVB checkpoint: %s", err)
+	}
+}
 
-				if errors.As(err, &fileSizeLimitReached) {
-					if recursionLevel > 0 {
-						return fmt.Errorf("file size limit reached, but dumpStore was called recursively")
-					}
-					// a new file was created, write the header and dump the whole store
-					writeCsvHeader(csvLogger)
-					err := l.DumpStore(s, csvLogger, true, recursionLevel+1)
+// restore loads the object dictionary saved before the restart
+func (l *Logger) restore(s processdatastore.ObjectStore) {
+	n, err := s.Restore(l.checkpointName())
+	if errors.Is(err, os.ErrNotExist) {
+		l.logger.Info().Msg("No MVB checkpoint to restore")
+		return
+	} else if err != nil {
+		l.logger.Warn().Msgf("Error restoring MVB checkpoint: %s", err)
+		return
+	}
+	l.restored = n
+	l.logger.Info().Msgf("Restored %d MVB addresses from checkpoint", n)
+}
 
-					if err != nil {
-						l.logger.Error().Msgf("Error dumping store: %s", err)
-					}
-					return nil
-				} else if errors.As(err, &diskFull) {
-					return err
-				} else if err != nil {
-					l.logger.Error().Msgf("Error writing csv entry: %s", err)
-				}
+// DumpStore dumps the process data store to a csv file
+// If dumpAll is true, all entries are dumped, otherwise the entries selected by the configured DumpMode.
+// Addresses that became stale get a marker row, addresses that recovered are always dumped.
+// If a signal catalog is configured, the decoded signals of the dumped entries are written to the signal csv file.
+// Entries that are dropped because the write queue is full are skipped. On any other error, the dump is aborted and the error is returned.
+func (l *Logger) DumpStore(s processdatastore.ObjectStore, csvLogger csvlogger.RecordWriter, dumpNumber int, dumpAll bool) error {
+	write := func(o processdatastore.Object, updates int, timing *processdatastore.TimingStats, status string) error {
+		err := l.writeCsvEntry(csvLogger, dumpNumber, o, updates, timing, status)
+		if l.signalLogger != nil && err == nil {
+			// errors of the signal file have been logged by its write error handler and do not stop the dump
+			l.writeSignalEntries(l.signalLogger, dumpNumber, o)
+		}
+		return err
+	}
+	for _, e := range s.Snapshot() {
+		if e.Stale {
+			l.logger.Warn().Msgf("MVB address %x is stale, last update at %s", e.Object.Address(), e.LastUpdate.Format(time.RFC3339))
+			err := l.writeCsvEntry(csvLogger, dumpNumber, e.Object, -1, nil, statusStale)
+			if err != nil && !isQueueFull(err) {
+				return err
+			}
+		}
+		status := ""
+		if e.Recovered {
+			l.logger.Warn().Msgf("MVB address %x recovered", e.Object.Address())
+			status = statusRecovered
+		} else if e.Restored {
+			status = statusRestored
+		}
+		if !dumpAll && !e.Recovered && !l.selected(e.Updates, e.Changed) {
+			continue
+		}
+		// intermediate values since the last dump, if a history is kept for the address
+		for i := 0; i < len(e.History)-1; i++ {
+			err := write(e.History[i], -1, nil, "")
+			if err != nil && !isQueueFull(err) {
+				return err
 			}
-		} else {
-			l.logger.Error().Msgf("Error reading process data store: %s", err)
+		}
+		err := write(e.Object, e.Updates, &e.Timing, status)
+		if err != nil && !isQueueFull(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// values of the status column
+const (
+	statusStale     = "stale"     // marker row, the address did not receive updates within its stale timeout
+	statusRecovered = "recovered" // the address received an update after it had been stale
+	statusRestored  = "restored"  // the value has been restored from the checkpoint saved before the restart
+)
+
+// isQueueFull checks whether the record was dropped because the write queue is full
+func isQueueFull(err error) bool {
+	var queueFull *csvlogger.QueueFull
+	return errors.As(err, &queueFull)
+}
+
+// selected checks whether an entry is dumped according to the configured DumpMode
+func (l *Logger) selected(updates int, changed bool) bool {
+	switch l.cfg.DumpMode {
+	case dumpOnChange:
+		return changed
+	case dumpAll:
+		return true
+	default:
+		return updates > 0
+	}
+}
+
+// handleWriteError is called from the writer goroutine of the AsyncWriter when writing a record failed
+func (l *Logger) handleWriteError(csvLogger *csvlogger.Writer, record []string, err error) error {
+	var fileSizeLimitReached *csvlogger.FileSizeLimitReached
+	var rotationTimeReached *csvlogger.RotationTimeReached
+	var diskFull *csvlogger.DiskFull
+
+	if errors.As(err, &fileSizeLimitReached) || errors.As(err, &rotationTimeReached) {
+		// a new file was created, write the header, all entries, so that the new file is complete, and the last entry again
+		l.writeCsvHeader(csvLogger)
+		err := l.writeStoreImage(csvLogger, record)
+		if err == nil {
+			err = csvLogger.Write(record)
+		}
+
+		if errors.As(err, &diskFull) {
+			l.logger.Error().Msgf("Disk full when writing csv entry: %s. Stop recording", err)
+			return err
+		} else if err != nil {
+			l.logger.Error().Msgf("Error writing csv entry: %s", err)
+		}
+	} else if errors.As(err, &diskFull) {
+		l.logger.Error().Msgf("Disk full when writing csv entry: %s. Stop recording", err)
+		return err
+	} else if err != nil {
+		l.logger.Error().Msgf("Error writing csv entry: %s", err)
+	}
+	return nil
+}
+
+// writeStoreImage writes the most recent object of each address with the dump number of record, the entry of the dump in progress.
+// The updates columns are left empty, since the updates are counted by the dump. The store is only peeked, so the dump in progress and
+// the next dump are not affected.
+func (l *Logger) writeStoreImage(csvLogger csvlogger.RecordWriter, record []string) error {
+	dumpNumber, err := strconv.Atoi(record[0])
+	if err != nil {
+		return fmt.Errorf("invalid dump number %q: %w", record[0], err)
+	}
+	for _, e := range l.store.Peek() {
+		status := ""
+		if e.Restored {
+			status = statusRestored
+		}
+		if err := l.writeCsvEntry(csvLogger, dumpNumber, e.Object, -1, nil, status); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func writeCsvHeader(csvLogger *csvlogger.Writer) {
-	csvLogger.Write([]string{
+func (l *Logger) writeCsvHeader(csvLogger csvlogger.RecordWriter) {
+	header := []string{
 		"Dump #",
 		"Address (hex)",
 		"Last Update - TimeSinceStart (us)",
+	}
+	if l.cfg.UTCColumn {
+		header = append(header, "Last Update - UTC")
+	}
+	header = append(header,
 		"Data (hex)",
 		"FCode (dec)",
 		"Updates (dec)",
-		time.Now().Format("2006-01-02 15:04:05"),
-	})
+	)
+	if l.cfg.TimingColumns {
+		header = append(header,
+			"Period (us)",
+			"Min Interval (us)",
+			"Max Interval (us)",
+			"Jitter (us)",
+		)
+	}
+	if l.statusColumn() {
+		header = append(header, "Status")
+	}
+	header = append(header, time.Now().Format("2006-01-02 15:04:05"))
+	csvLogger.Write(header)
+}
+
+// timingColumns returns the period, min and max interval and jitter in microseconds, or empty columns if there is no interval
+func timingColumns(timing *processdatastore.TimingStats) []string {
+	if timing == nil || timing.Intervals == 0 {
+		return []string{"", "", "", ""}
+	}
+	return []string{
+		strconv.FormatInt(timing.Mean.Microseconds(), 10),
+		strconv.FormatInt(timing.Min.Microseconds(), 10),
+		strconv.FormatInt(timing.Max.Microseconds(), 10),
+		strconv.FormatInt(timing.Jitter.Microseconds(), 10),
+	}
+}
+
+// statusColumn checks whether the csv file has a status column, which is needed for stale, recovered and restored markers
+func (l *Logger) statusColumn() bool {
+	return l.cfg.Stale.Timeout > 0 || len(l.cfg.Stale.Addresses) > 0 || l.cfg.CheckpointInterval > 0
 }
 
-func (l *Logger) writeCsvEntry(csvLogger *csvlogger.Writer, o processdatastore.Object, updates int) error {
-	err := csvLogger.Write([]string{
-		strconv.Itoa(l.dumpNumber),
+// writeCsvEntry writes the object o. If updates is negative, the updates column is left empty, e.g. for intermediate values.
+// timing and status are written to the timing and status columns, if present. timing may be nil.
+func (l *Logger) writeCsvEntry(csvLogger csvlogger.RecordWriter, dumpNumber int, o processdatastore.Object, updates int, timing *processdatastore.TimingStats, status string) error {
+	updatesColumn := ""
+	if updates >= 0 {
+		updatesColumn = strconv.Itoa(updates)
+	}
+	fcodeColumn := ""
+	if info := o.AdditionalInfo(); len(info) > 0 {
+		// restored objects from a checkpoint without F-code have no info
+		fcodeColumn = info[0]
+	}
+	record := []string{
+		strconv.Itoa(dumpNumber),
 		fmt.Sprintf("%x", o.Address()),
 		fmt.Sprintf("%d", o.Timestamp()),
+	}
+	if l.cfg.UTCColumn {
+		record = append(record, l.clock.FormatUTC(o.Timestamp()))
+	}
+	record = append(record,
 		hex.EncodeToString(o.Data()),
-		o.AdditionalInfo()[0],
-		strconv.Itoa(updates),
-	})
+		fcodeColumn,
+		updatesColumn,
+	)
+	if l.cfg.TimingColumns {
+		record = append(record, timingColumns(timing)...)
+	}
+	if l.statusColumn() {
+		record = append(record, status)
+	}
+	err := csvLogger.WriteWithTimestamp(record, o.Timestamp())
 	if err != nil {
 		return err
 	}
-	l.lineCount++
+	atomic.AddInt64(&l.lineCount, 1)
 
 	return nil
 }
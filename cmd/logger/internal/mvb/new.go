@@ -3,45 +3,108 @@ package mvb
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/ci4rail/velog/cmd/logger/internal/output"
+	"github.com/ci4rail/velog/pkg/clockcorrelation"
+	"github.com/ci4rail/velog/pkg/csvlogger"
+	"github.com/ci4rail/velog/pkg/mvbframe"
+	"github.com/ci4rail/velog/pkg/mvbsignal"
+	"github.com/ci4rail/velog/pkg/processdatastore"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
+const defaultQueueSize = 10000
+
+// dump modes, see configuration.DumpMode
+const (
+	dumpOnChange = "onChange" // dump addresses whose data changed since the last dump
+	dumpOnUpdate = "onUpdate" // dump addresses that received any update since the last dump
+	dumpAll      = "all"      // dump all addresses
+)
+
+type historyConfiguration struct {
+	Depth     int                           // number of intermediate values to keep for all addresses, 0 means none
+	Addresses []addressHistoryConfiguration // number of intermediate values to keep per address, overrides Depth
+}
+
+type addressHistoryConfiguration struct {
+	Address uint32 // MVB port address
+	Depth   int    // number of intermediate values to keep, 0 means none
+}
+
+type staleConfiguration struct {
+	Timeout   time.Duration               // time without update after which an address is stale, for all addresses, 0 means never
+	Addresses []addressStaleConfiguration // timeout per address, overrides Timeout
+}
+
+type addressStaleConfiguration struct {
+	Address uint32        // MVB port address
+	Timeout time.Duration // time without update after which the address is stale, 0 means never
+}
+
 type configuration struct {
-	SnifferDevice string // e.g. "S101-IOU03-USB-EXT-1-mvbSniffer"
-	FileName      string // prefix for log files e.g. "mvb"
-	DumpInterval  int    // how often to dump the store to csv file in ms
+	SnifferDevice      string                      // e.g. "S101-IOU03-USB-EXT-1-mvbSniffer"
+	FileName           string                      // prefix or template for log files e.g. "mvb" or "{vehicle}_{bus}_{date}_{index}.csv"
+	DumpInterval       int                         // how often to dump the store to csv file in ms
+	Filters            []filterConfiguration       // sniffer filters, default all process data telegrams except timed out frames
+	DumpMode           string                      // which addresses to dump, "onChange", "onUpdate" or "all", default "onUpdate"
+	ChangeFilters      []changeFilterConfiguration // masks and deadbands that decide whether an address counts as changed
+	History            historyConfiguration        // addresses whose intermediate values between two dumps are written
+	Stale              staleConfiguration          // timeouts to detect addresses that stopped receiving updates
+	TimingColumns      bool                        // add columns with the update period, min and max interval and jitter since the previous dump
+	Raw                rawConfiguration            // write every received telegram to a separate csv file
+	Supervisory        supervisoryConfiguration    // write the supervisory and message data frames to a separate csv file
+	Inventory          inventoryConfiguration      // collect the devices that answer device status requests
+	Signals            signalsConfiguration        // signal catalog to write decoded engineering values to a separate csv file
+	CheckpointInterval time.Duration               // interval to save the object dictionary, which is restored after a restart, 0 disables it
+	QueueSize          int                         // number of records that can be queued for writing, default 10000
+	UTCColumn          bool                        // add a column with the UTC time of the device timestamp in ISO-8601 format
+	output.Files       `mapstructure:",squash"`    // file limits, rotation, compression, durability and manifest
+
+	catalog *mvbsignal.Catalog // created from Signals, nil if no signals are configured
 }
 
 // Logger is the instance of the MVB logger
 type Logger struct {
-	cfg        *configuration
-	outputDir  string
-	logger     zerolog.Logger
-	ctx        context.Context
-	lineCount  int
-	dumpNumber int
+	cfg              *configuration
+	out              *output.Config
+	logger           zerolog.Logger
+	ctx              context.Context
+	clock            *clockcorrelation.Correlator // maps device timestamps to UTC
+	lineCount        int64                        // accessed atomically
+	store            processdatastore.ObjectStore // the object dictionary, written to each new dump file by the write error handler
+	dumpNumber       int
+	telegram         TelegramObject                                         // reused for each received telegram
+	restored         int                                                    // number of addresses restored from the checkpoint
+	rawAddresses     [processdatastore.FixedStoreSize]bool                  // addresses to write to the raw csv file
+	deviceStatus     [processdatastore.FixedStoreSize]mvbframe.DeviceStatus // last device status of each device
+	statusSeen       [processdatastore.FixedStoreSize]bool                  // whether a device status has been received
+	inventory        *mvbframe.Inventory                                    // devices that answer device status requests, nil if disabled
+	inventoryChanged int32                                                  // accessed atomically, 1 if the session manifest needs an update
+	signalLogger     *csvlogger.AsyncWriter                                 // writes the decoded signals, nil if no signals are configured
 }
 
 // NewFromViper creates a new MVB Unit from a viper configuration
-func NewFromViper(ctx context.Context, viperCfg *viper.Viper, outputDir string) (*Logger, error) {
+func NewFromViper(ctx context.Context, viperCfg *viper.Viper, out *output.Config) (*Logger, error) {
 	cfg, err := readConfig(viperCfg)
 	if err != nil {
 		return nil, err
 	}
-	return New(ctx, cfg, outputDir), nil
+	return New(ctx, cfg, out), nil
 }
 
 // New creates a new instance of MVB Unit
-func New(ctx context.Context, cfg *configuration, outputDir string) *Logger {
+func New(ctx context.Context, cfg *configuration, out *output.Config) *Logger {
 
 	l := &Logger{
 		cfg:        cfg,
-		outputDir:  outputDir,
+		out:        out,
 		logger:     log.With().Str("component", "MVB").Logger(),
 		ctx:        ctx,
+		clock:      clockcorrelation.New(),
 		lineCount:  0,
 		dumpNumber: 0,
 	}
@@ -60,6 +123,40 @@ func readConfig(sub *viper.Viper) (*configuration, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal config %s", err)
 	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = defaultQueueSize
+	} else if cfg.QueueSize < 0 {
+		return nil, fmt.Errorf("invalid queue size %d", cfg.QueueSize)
+	}
+	switch cfg.DumpMode {
+	case "":
+		cfg.DumpMode = dumpOnUpdate
+	case dumpOnChange, dumpOnUpdate, dumpAll:
+	default:
+		return nil, fmt.Errorf("invalid dump mode %q, must be %s, %s or %s", cfg.DumpMode, dumpOnChange, dumpOnUpdate, dumpAll)
+	}
+	if cfg.History.Depth < 0 {
+		return nil, fmt.Errorf("invalid history depth %d", cfg.History.Depth)
+	}
+	for _, h := range cfg.History.Addresses {
+		if h.Depth < 0 {
+			return nil, fmt.Errorf("invalid history depth %d for address %x", h.Depth, h.Address)
+		}
+	}
+	for i, f := range cfg.Filters {
+		if _, err := f.filterMask(); err != nil {
+			return nil, fmt.Errorf("invalid filter %d: %s", i, err)
+		}
+	}
+	for _, c := range cfg.ChangeFilters {
+		if _, err := c.changeFilter(); err != nil {
+			return nil, fmt.Errorf("invalid change filter: %s", err)
+		}
+	}
+	cfg.catalog, err = cfg.Signals.catalog()
+	if err != nil {
+		return nil, fmt.Errorf("invalid signal catalog: %s", err)
+	}
 
 	return &cfg, nil
 }
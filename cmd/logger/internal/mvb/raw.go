@@ -0,0 +1,121 @@
+package mvb
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mvbpb "github.com/ci4rail/io4edge_api/mvbSniffer/go/mvbSniffer/v1"
+	"github.com/ci4rail/velog/pkg/csvlogger"
+)
+
+const defaultRawFileName = "mvbraw"
+
+type rawConfiguration struct {
+	Enable    bool     // write every received telegram to a separate csv file
+	FileName  string   // prefix or template for raw log files, default "mvbraw". The {bus} placeholder is "mvbraw".
+	Addresses []uint32 // addresses to write, all if empty
+}
+
+// newRawLogger creates the writer for the raw telegram csv files
+func (l *Logger) newRawLogger() (*csvlogger.AsyncWriter, error) {
+	for _, address := range l.cfg.Raw.Addresses {
+		l.rawAddresses[address&0xfff] = true
+	}
+	fileName := l.cfg.Raw.FileName
+	if fileName == "" {
+		fileName = defaultRawFileName
+	}
+	csvLogger, err := l.newCsvWriter(fileName, "mvbraw")
+	if err != nil {
+		return nil, err
+	}
+	rawLogger := csvlogger.NewAsyncWriter(csvLogger, l.cfg.QueueSize, l.handleRawWriteError)
+	l.writeRawCsvHeader(rawLogger)
+	return rawLogger, nil
+}
+
+// logRawTelegram writes the telegram to the raw csv file, if its address is selected
+func (l *Logger) logRawTelegram(rawLogger csvlogger.RecordWriter, telegram *mvbpb.Telegram) {
+	if len(l.cfg.Raw.Addresses) > 0 && !l.rawAddresses[telegram.Address&0xfff] {
+		return
+	}
+	// the AsyncWriter counts the dropped telegrams, other errors have been logged by the write error handler
+	l.writeRawCsvEntry(rawLogger, telegram)
+}
+
+// handleRawWriteError is called from the writer goroutine of the AsyncWriter when writing record failed
+func (l *Logger) handleRawWriteError(csvLogger *csvlogger.Writer, record []string, err error) error {
+	var fileSizeLimitReached *csvlogger.FileSizeLimitReached
+	var rotationTimeReached *csvlogger.RotationTimeReached
+	var diskFull *csvlogger.DiskFull
+
+	if errors.As(err, &fileSizeLimitReached) || errors.As(err, &rotationTimeReached) {
+		// a new file was created, write the header and the last entry again
+		l.writeRawCsvHeader(csvLogger)
+		err := csvLogger.Write(record)
+
+		if err != nil {
+			l.logger.Error().Msgf("Error writing raw csv entry: %s", err)
+		}
+	} else if errors.As(err, &diskFull) {
+		l.logger.Error().Msgf("Disk full when writing raw csv entry: %s. Stop raw recording", err)
+		return err
+	} else if err != nil {
+		l.logger.Error().Msgf("Error writing raw csv entry: %s", err)
+	}
+	return nil
+}
+
+func (l *Logger) writeRawCsvHeader(csvLogger csvlogger.RecordWriter) {
+	header := []string{"TimeSinceStart (us)"}
+	if l.cfg.UTCColumn {
+		header = append(header, "UTC")
+	}
+	header = append(header,
+		"Address (hex)",
+		"FCode (dec)",
+		"Data (hex)",
+		"State",
+		time.Now().Format("2006-01-02 15:04:05"),
+	)
+	csvLogger.Write(header)
+}
+
+func (l *Logger) writeRawCsvEntry(csvLogger csvlogger.RecordWriter, telegram *mvbpb.Telegram) error {
+	record := []string{strconv.FormatUint(telegram.Timestamp, 10)}
+	if l.cfg.UTCColumn {
+		record = append(record, l.clock.FormatUTC(int64(telegram.Timestamp)))
+	}
+	record = append(record,
+		fmt.Sprintf("%x", telegram.Address),
+		strconv.Itoa(int(telegram.Type)),
+		hex.EncodeToString(telegram.Data),
+		stateFlags(telegram.State),
+	)
+	err := csvLogger.WriteWithTimestamp(record, int64(telegram.Timestamp))
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&l.lineCount, 1)
+	return nil
+}
+
+// stateFlags returns the names of the state flags of a telegram, separated by '|', or an empty string if the telegram was successful
+func stateFlags(state uint32) string {
+	var flags []string
+	if state&uint32(mvbpb.Telegram_kTimedOut) != 0 {
+		flags = append(flags, "timedOut")
+	}
+	if state&uint32(mvbpb.Telegram_kMissedMVBFrames) != 0 {
+		flags = append(flags, "missedMVBFrames")
+	}
+	if state&uint32(mvbpb.Telegram_kMissedTelegrams) != 0 {
+		flags = append(flags, "missedTelegrams")
+	}
+	return strings.Join(flags, "|")
+}
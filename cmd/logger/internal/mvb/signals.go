@@ -0,0 +1,146 @@
+package mvb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ci4rail/velog/pkg/csvlogger"
+	"github.com/ci4rail/velog/pkg/mvbsignal"
+	"github.com/ci4rail/velog/pkg/processdatastore"
+	"github.com/spf13/viper"
+)
+
+const defaultSignalsFileName = "mvbsig"
+
+type signalsConfiguration struct {
+	Catalog  []mvbsignal.Signal // signals defined in the configuration
+	File     string             // yaml file with a "signals" list, or csv file with further signals
+	FileName string             // prefix or template for decoded signal files, default "mvbsig". The {bus} placeholder is "mvbsig".
+}
+
+// catalog creates the signal catalog from the configured signals and the signal file.
+// It returns nil if no signals are configured.
+func (c *signalsConfiguration) catalog() (*mvbsignal.Catalog, error) {
+	signals := c.Catalog
+	if c.File != "" {
+		fileSignals, err := readSignalFile(c.File)
+		if err != nil {
+			return nil, fmt.Errorf("signal file %s: %s", c.File, err)
+		}
+		signals = append(signals, fileSignals...)
+	}
+	if len(signals) == 0 {
+		return nil, nil
+	}
+	return mvbsignal.NewCatalog(signals)
+}
+
+// readSignalFile reads the signals of a csv or yaml file
+func readSignalFile(name string) ([]mvbsignal.Signal, error) {
+	if strings.ToLower(filepath.Ext(name)) == ".csv" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return mvbsignal.ReadCSV(f)
+	}
+	v := viper.New()
+	v.SetConfigFile(name)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var signals []mvbsignal.Signal
+	if err := v.UnmarshalKey("signals", &signals); err != nil {
+		return nil, err
+	}
+	return signals, nil
+}
+
+// newSignalLogger creates the writer for the decoded signal csv files
+func (l *Logger) newSignalLogger() (*csvlogger.AsyncWriter, error) {
+	fileName := l.cfg.Signals.FileName
+	if fileName == "" {
+		fileName = defaultSignalsFileName
+	}
+	csvLogger, err := l.newCsvWriter(fileName, "mvbsig")
+	if err != nil {
+		return nil, err
+	}
+	l.logger.Info().Msgf("Decoding %d MVB signals", l.cfg.catalog.Len())
+	sigLogger := csvlogger.NewAsyncWriter(csvLogger, l.cfg.QueueSize, l.handleSignalWriteError)
+	l.writeSignalCsvHeader(sigLogger)
+	return sigLogger, nil
+}
+
+// handleSignalWriteError is called from the writer goroutine of the AsyncWriter when writing record failed
+func (l *Logger) handleSignalWriteError(csvLogger *csvlogger.Writer, record []string, err error) error {
+	var fileSizeLimitReached *csvlogger.FileSizeLimitReached
+	var rotationTimeReached *csvlogger.RotationTimeReached
+	var diskFull *csvlogger.DiskFull
+
+	if errors.As(err, &fileSizeLimitReached) || errors.As(err, &rotationTimeReached) {
+		// a new file was created, write the header and the last entry again
+		l.writeSignalCsvHeader(csvLogger)
+		err := csvLogger.Write(record)
+
+		if err != nil {
+			l.logger.Error().Msgf("Error writing signal csv entry: %s", err)
+		}
+	} else if errors.As(err, &diskFull) {
+		l.logger.Error().Msgf("Disk full when writing signal csv entry: %s. Stop signal recording", err)
+		return err
+	} else if err != nil {
+		l.logger.Error().Msgf("Error writing signal csv entry: %s", err)
+	}
+	return nil
+}
+
+func (l *Logger) writeSignalCsvHeader(csvLogger csvlogger.RecordWriter) {
+	header := []string{
+		"Dump #",
+		"Address (hex)",
+		"Last Update - TimeSinceStart (us)",
+	}
+	if l.cfg.UTCColumn {
+		header = append(header, "Last Update - UTC")
+	}
+	header = append(header,
+		"Signal",
+		"Value",
+		"Unit",
+		time.Now().Format("2006-01-02 15:04:05"),
+	)
+	csvLogger.Write(header)
+}
+
+// writeSignalEntries writes the decoded values of the signals of the object, one row per signal.
+// The value is empty if the signal could not be decoded, e.g. because the port data is too short.
+func (l *Logger) writeSignalEntries(csvLogger csvlogger.RecordWriter, dumpNumber int, o processdatastore.Object) error {
+	for _, s := range l.cfg.catalog.Signals(o.Address()) {
+		value := ""
+		if v, err := s.Decode(o.Data()); err == nil {
+			value = s.Format(v)
+		}
+		record := []string{
+			strconv.Itoa(dumpNumber),
+			fmt.Sprintf("%x", o.Address()),
+			fmt.Sprintf("%d", o.Timestamp()),
+		}
+		if l.cfg.UTCColumn {
+			record = append(record, l.clock.FormatUTC(o.Timestamp()))
+		}
+		record = append(record, s.Name, value, s.Unit)
+		if err := csvLogger.WriteWithTimestamp(record, o.Timestamp()); err != nil {
+			return err
+		}
+		atomic.AddInt64(&l.lineCount, 1)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package mvb
+
+import (
+	"fmt"
+
+	"github.com/ci4rail/io4edge-client-go/mvbsniffer"
+)
+
+// defaultFilter receives any process data telegram, except timed out frames
+var defaultFilter = filterConfiguration{
+	FCodes: []int{0, 1, 2, 3, 4},
+}
+
+type filterConfiguration struct {
+	FCodes                []int  // F-codes to receive, e.g. [0, 1, 2, 3, 4] for all process data
+	Address               uint16 // address to compare
+	Mask                  uint16 // bits of the address to compare, 0 receives all addresses
+	IncludeTimedoutFrames bool   // also receive frames without slave response
+}
+
+// filterMask converts the configuration to a sniffer filter mask
+func (c *filterConfiguration) filterMask() (mvbsniffer.FilterMask, error) {
+	if len(c.FCodes) == 0 {
+		return mvbsniffer.FilterMask{}, fmt.Errorf("no F-codes selected")
+	}
+	var fcodeMask uint16
+	for _, fcode := range c.FCodes {
+		if fcode < 0 || fcode > 15 {
+			return mvbsniffer.FilterMask{}, fmt.Errorf("invalid F-code %d", fcode)
+		}
+		fcodeMask |= 1 << fcode
+	}
+	if c.Address > 0xfff || c.Mask > 0xfff {
+		return mvbsniffer.FilterMask{}, fmt.Errorf("address %x and mask %x must be 12 bit", c.Address, c.Mask)
+	}
+	return mvbsniffer.FilterMask{
+		FCodeMask:             fcodeMask,
+		Address:               c.Address,
+		Mask:                  c.Mask,
+		IncludeTimedoutFrames: c.IncludeTimedoutFrames,
+	}, nil
+}
+
+// filterOptions returns the stream options for the configured filters, or for the default filters if none is configured
+func (l *Logger) filterOptions() ([]mvbsniffer.StreamConfigOption, error) {
+	filters := l.cfg.Filters
+	if len(filters) == 0 {
+		filters = []filterConfiguration{defaultFilter}
+		if l.cfg.Supervisory.Enable {
+			filters = append(filters, supervisoryFilter)
+		} else if l.cfg.Inventory.Enable {
+			filters = append(filters, inventoryFilter)
+		}
+	}
+	var opts []mvbsniffer.StreamConfigOption
+	for i, f := range filters {
+		mask, err := f.filterMask()
+		if err != nil {
+			return nil, fmt.Errorf("filter %d: %s", i, err)
+		}
+		opts = append(opts, mvbsniffer.WithFilterMask(mask))
+	}
+	return opts, nil
+}
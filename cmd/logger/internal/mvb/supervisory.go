@@ -0,0 +1,143 @@
+package mvb
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	mvbpb "github.com/ci4rail/io4edge_api/mvbSniffer/go/mvbSniffer/v1"
+	"github.com/ci4rail/velog/pkg/csvlogger"
+	"github.com/ci4rail/velog/pkg/mvbframe"
+)
+
+const defaultSupervisoryFileName = "mvbsup"
+
+// supervisoryFilter receives the supervisory and message data frames, if no filters are configured
+var supervisoryFilter = filterConfiguration{
+	FCodes: []int{8, 9, 10, 11, 12, 13, 14, 15},
+}
+
+type supervisoryConfiguration struct {
+	Enable   bool   // write the supervisory and message data frames (F-code 8..15) to a separate csv file
+	FileName string // prefix or template for supervisory log files, default "mvbsup". The {bus} placeholder is "mvbsup".
+}
+
+// newSupervisoryLogger creates the writer for the supervisory csv files
+func (l *Logger) newSupervisoryLogger() (*csvlogger.AsyncWriter, error) {
+	fileName := l.cfg.Supervisory.FileName
+	if fileName == "" {
+		fileName = defaultSupervisoryFileName
+	}
+	csvLogger, err := l.newCsvWriter(fileName, "mvbsup")
+	if err != nil {
+		return nil, err
+	}
+	supLogger := csvlogger.NewAsyncWriter(csvLogger, l.cfg.QueueSize, l.handleSupervisoryWriteError)
+	l.writeSupervisoryCsvHeader(supLogger)
+	return supLogger, nil
+}
+
+// isSupervisory checks whether the telegram is a supervisory or message data frame
+func isSupervisory(telegram *mvbpb.Telegram) bool {
+	return telegram.Type >= mvbpb.Telegram_kMastershipTransfer
+}
+
+// logSupervisoryTelegram writes the telegram to the supervisory csv file.
+// Device status responses are only written when the status of the device has changed, timed out requests are not written.
+func (l *Logger) logSupervisoryTelegram(supLogger csvlogger.RecordWriter, telegram *mvbpb.Telegram) {
+	var status string
+	if telegram.Type == mvbpb.Telegram_kDeviceStatus {
+		s, ok := mvbframe.ParseDeviceStatus(telegram.Data)
+		if !ok {
+			return
+		}
+		address := telegram.Address & 0xfff
+		if l.statusSeen[address] && l.deviceStatus[address] == s {
+			return
+		}
+		l.statusSeen[address] = true
+		l.deviceStatus[address] = s
+		status = s.String()
+	}
+	// the AsyncWriter counts the dropped telegrams, other errors have been logged by the write error handler
+	l.writeSupervisoryCsvEntry(supLogger, telegram, status)
+}
+
+// handleSupervisoryWriteError is called from the writer goroutine of the AsyncWriter when writing record failed
+func (l *Logger) handleSupervisoryWriteError(csvLogger *csvlogger.Writer, record []string, err error) error {
+	var fileSizeLimitReached *csvlogger.FileSizeLimitReached
+	var rotationTimeReached *csvlogger.RotationTimeReached
+	var diskFull *csvlogger.DiskFull
+
+	if errors.As(err, &fileSizeLimitReached) || errors.As(err, &rotationTimeReached) {
+		// a new file was created, write the header and the last entry again
+		l.writeSupervisoryCsvHeader(csvLogger)
+		err := csvLogger.Write(record)
+
+		if err != nil {
+			l.logger.Error().Msgf("Error writing supervisory csv entry: %s", err)
+		}
+	} else if errors.As(err, &diskFull) {
+		l.logger.Error().Msgf("Disk full when writing supervisory csv entry: %s. Stop supervisory recording", err)
+		return err
+	} else if err != nil {
+		l.logger.Error().Msgf("Error writing supervisory csv entry: %s", err)
+	}
+	return nil
+}
+
+func (l *Logger) writeSupervisoryCsvHeader(csvLogger csvlogger.RecordWriter) {
+	header := []string{"TimeSinceStart (us)"}
+	if l.cfg.UTCColumn {
+		header = append(header, "UTC")
+	}
+	header = append(header,
+		"FCode (dec)",
+		"Frame Type",
+		"Address (hex)",
+		"Source (hex)",
+		"Destination (hex)",
+		"Data (hex)",
+		"Device Status",
+		"State",
+		time.Now().Format("2006-01-02 15:04:05"),
+	)
+	csvLogger.Write(header)
+}
+
+func (l *Logger) writeSupervisoryCsvEntry(csvLogger csvlogger.RecordWriter, telegram *mvbpb.Telegram, status string) error {
+	fcode := int(telegram.Type)
+	source, destination := mvbframe.Addresses(fcode, uint32(telegram.Address), telegram.Data)
+
+	record := []string{strconv.FormatUint(telegram.Timestamp, 10)}
+	if l.cfg.UTCColumn {
+		record = append(record, l.clock.FormatUTC(int64(telegram.Timestamp)))
+	}
+	record = append(record,
+		strconv.Itoa(fcode),
+		mvbframe.FrameType(fcode),
+		fmt.Sprintf("%x", telegram.Address),
+		deviceAddress(source),
+		deviceAddress(destination),
+		hex.EncodeToString(telegram.Data),
+		status,
+		stateFlags(telegram.State),
+	)
+	err := csvLogger.WriteWithTimestamp(record, int64(telegram.Timestamp))
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&l.lineCount, 1)
+	return nil
+}
+
+// deviceAddress formats a device address in hex, or returns an empty string if the address is unknown
+func deviceAddress(address int) string {
+	if address < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%x", address)
+}
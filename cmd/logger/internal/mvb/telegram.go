@@ -11,12 +11,6 @@ type TelegramObject struct {
 	telegram *mvbpb.Telegram
 }
 
-func newTelegramObject(telegram *mvbpb.Telegram) *TelegramObject {
-	return &TelegramObject{
-		telegram: telegram,
-	}
-}
-
 // Timestamp returns the timestamp of the telegram
 func (t *TelegramObject) Timestamp() int64 {
 	return int64(t.telegram.Timestamp)
@@ -32,6 +26,11 @@ func (t *TelegramObject) Data() []byte {
 	return t.telegram.Data
 }
 
+// InfoCode returns the F-code of the telegram
+func (t *TelegramObject) InfoCode() int {
+	return int(t.telegram.Type)
+}
+
 // AdditionalInfo returns additional information about the telegram
 func (t *TelegramObject) AdditionalInfo() []string {
 	strArr := []string{
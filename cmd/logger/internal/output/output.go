@@ -0,0 +1,72 @@
+// Package output holds the settings that all loggers share for writing their files
+package output
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ci4rail/velog/cmd/logger/internal/session"
+	"github.com/ci4rail/velog/internal/version"
+	"github.com/ci4rail/velog/pkg/csvlogger"
+)
+
+// Config holds the settings that all loggers share for writing their files
+type Config struct {
+	Dir        string                // directory to write the files to
+	BaseDir    string                // directory that contains Dir, e.g. if Dir is a session directory, searched for files left over from previous runs
+	VehicleID  string                // value of the {vehicle} file name placeholder
+	Retention  *csvlogger.Retention  // may be nil, in which case recording stops when the disk is full
+	Compressor *csvlogger.Compressor // compresses closed files in the background
+	Session    *session.Session      // nil if sessions are disabled
+}
+
+// Files holds the file settings of a logger. It is embedded into the configuration of each logger,
+// so that all loggers have the same file settings.
+type Files struct {
+	MaxFileSize      int64                // maximum size of a log file in bytes, 0 means no limit
+	MaxLines         int                  // maximum number of lines of a log file, 0 means no limit
+	Compress         bool                 // write gzip compressed files (.csv.gz)
+	CompressClosed   bool                 // gzip files in the background after they have been closed
+	Manifest         bool                 // write a JSON manifest next to each file
+	Durability       csvlogger.Durability // flush and fsync policy
+	RotationInterval time.Duration        // start a new file on wall-clock boundaries, e.g. 1h or 24h, 0 means no time based rotation
+}
+
+// NewWriter creates a csv writer in the output directory.
+// fileName is a prefix or a file name template, bus is the value of the {bus} file name placeholder.
+func (c *Config) NewWriter(fileName string, bus string) *csvlogger.Writer {
+	w := csvlogger.NewWriter(c.Dir, fileName)
+	w.TemplateValues = map[string]string{
+		"vehicle": c.VehicleID,
+		"bus":     bus,
+	}
+	w.Retention = c.Retention
+	w.LeftoverDir = c.BaseDir
+	return w
+}
+
+// NewFileWriter creates a csv writer in the output directory like NewWriter, with the file limits, rotation, compression,
+// durability and manifest of files. The manifests record the sniffer device and the hash of cfg, the configuration of the logger.
+func (c *Config) NewFileWriter(fileName string, bus string, files *Files, device string, cfg interface{}) (*csvlogger.Writer, error) {
+	w := c.NewWriter(fileName, bus)
+	w.MaxFileSize = files.MaxFileSize
+	w.MaxLines = files.MaxLines
+	w.RotationInterval = files.RotationInterval
+	w.Compress = files.Compress
+	w.Durability = files.Durability
+	if files.CompressClosed {
+		w.Compressor = c.Compressor
+	}
+	if files.Manifest {
+		configHash, err := csvlogger.HashConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error hashing configuration: %s", err)
+		}
+		w.Manifest = &csvlogger.ManifestInfo{
+			Version:    version.Version,
+			Device:     device,
+			ConfigHash: configHash,
+		}
+	}
+	return w, nil
+}
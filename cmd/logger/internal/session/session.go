@@ -0,0 +1,126 @@
+// Package session creates a directory for the files written during one run of velog
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ManifestName is the name of the session manifest in the session directory
+const ManifestName = "session.json"
+
+// sessionDir matches the name of a session directory, the first group is the session number
+var sessionDir = regexp.MustCompile(`_sess(\d+)$`)
+
+// Session is one run of velog. All loggers write their files into the session directory.
+type Session struct {
+	Dir      string
+	mu       sync.Mutex
+	manifest Manifest
+	sections map[string]func() interface{}
+}
+
+// Manifest describes a session. It is written to the session directory when the session starts and updated when it stops.
+type Manifest struct {
+	Session int                    `json:"session"`
+	Version string                 `json:"version"`
+	Start   time.Time              `json:"start"`
+	Stop    *time.Time             `json:"stop,omitempty"` // missing if velog was not stopped properly, e.g. on power loss
+	Config  map[string]interface{} `json:"config"`
+	// Sections are added by the loggers, e.g. the MVB device inventory
+	Sections map[string]interface{} `json:"sections,omitempty"`
+}
+
+// New creates a session directory in baseDir, named by the start time and the next session number,
+// e.g. 2026-10-17T08-12-03_sess0045, and writes the session manifest with version and config.
+func New(baseDir string, version string, config map[string]interface{}) (*Session, error) {
+	number, err := nextNumber(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	dir := filepath.Join(baseDir, fmt.Sprintf("%s_sess%04d", start.Format("2006-01-02T15-04-05"), number))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Session{
+		Dir: dir,
+		manifest: Manifest{
+			Session: number,
+			Version: version,
+			Start:   start,
+			Config:  config,
+		},
+		sections: make(map[string]func() interface{}),
+	}
+	return s, s.writeManifest()
+}
+
+// AddSection adds a section to the session manifest. snapshot is called whenever the manifest is written
+// and returns the content of the section, which must be marshallable to JSON.
+func (s *Session) AddSection(name string, snapshot func() interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sections[name] = snapshot
+}
+
+// Update writes the session manifest with the current content of the sections
+func (s *Session) Update() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeManifest()
+}
+
+// Close records the stop time in the session manifest
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stop := time.Now()
+	s.manifest.Stop = &stop
+	return s.writeManifest()
+}
+
+// writeManifest writes the manifest via a temporary file, so that a power loss never leaves a truncated manifest
+func (s *Session) writeManifest() error {
+	if len(s.sections) > 0 {
+		s.manifest.Sections = make(map[string]interface{}, len(s.sections))
+		for name, snapshot := range s.sections {
+			s.manifest.Sections[name] = snapshot()
+		}
+	}
+	data, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(s.Dir, ManifestName)
+	if err := os.WriteFile(name+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// nextNumber returns the number following the highest session number in baseDir
+func nextNumber(baseDir string) (int, error) {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return 0, err
+	}
+	highest := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if m := sessionDir.FindStringSubmatch(entry.Name()); m != nil {
+			if n, err := strconv.Atoi(m[1]); err == nil && n > highest {
+				highest = n
+			}
+		}
+	}
+	return highest + 1, nil
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readManifest(t *testing.T, dir string) Manifest {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	assert.NoError(t, err)
+	var m Manifest
+	assert.NoError(t, json.Unmarshal(data, &m))
+	return m
+}
+
+func TestNextNumber(t *testing.T) {
+	baseDir := t.TempDir()
+
+	n, err := nextNumber(baseDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	os.Mkdir(filepath.Join(baseDir, "2026-10-16T08-00-00_sess0003"), 0755)
+	os.Mkdir(filepath.Join(baseDir, "2026-10-15T08-00-00_sess0010"), 0755)
+	os.Mkdir(filepath.Join(baseDir, "sess0099_old"), 0755)
+	os.WriteFile(filepath.Join(baseDir, "mvb_sess0050"), nil, 0644)
+
+	n, err = nextNumber(baseDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+
+	_, err = nextNumber(filepath.Join(baseDir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestSession(t *testing.T) {
+	baseDir := t.TempDir()
+	config := map[string]interface{}{"sessions": true}
+
+	s, err := New(baseDir, "1.2.3", config)
+	assert.NoError(t, err)
+	assert.DirExists(t, s.Dir)
+	assert.Regexp(t, `^\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}_sess0001$`, filepath.Base(s.Dir))
+
+	m := readManifest(t, s.Dir)
+	assert.Equal(t, 1, m.Session)
+	assert.Equal(t, "1.2.3", m.Version)
+	assert.Equal(t, config, m.Config)
+	assert.Nil(t, m.Stop)
+	assert.Nil(t, m.Sections)
+
+	devices := []string{"a"}
+	s.AddSection("devices", func() interface{} { return devices })
+	devices = append(devices, "b")
+	assert.NoError(t, s.Update())
+	m = readManifest(t, s.Dir)
+	assert.Equal(t, []interface{}{"a", "b"}, m.Sections["devices"])
+	assert.Nil(t, m.Stop)
+
+	assert.NoError(t, s.Close())
+	m = readManifest(t, s.Dir)
+	assert.NotNil(t, m.Stop)
+	assert.False(t, m.Stop.Before(m.Start))
+	assert.NoFileExists(t, filepath.Join(s.Dir, ManifestName+".tmp"))
+
+	// the next session gets the next number, even within the same second
+	s2, err := New(baseDir, "1.2.3", config)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, readManifest(t, s2.Dir).Session)
+	assert.NotEqual(t, s.Dir, s2.Dir)
+}
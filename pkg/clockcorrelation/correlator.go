@@ -0,0 +1,162 @@
+// Package clockcorrelation maps the timestamps of an io4edge device (microseconds since device start) to UTC.
+package clockcorrelation
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultResampleInterval is used if Correlator.ResampleInterval is not set
+	DefaultResampleInterval = 10 * time.Second
+	// DefaultRestartTolerance is used if Correlator.RestartTolerance is not set
+	DefaultRestartTolerance = time.Second
+	// ISO8601 is the format of FormatUTC, with microsecond resolution like the device timestamps
+	ISO8601 = "2006-01-02T15:04:05.000000Z"
+	// maxDrift is the maximum accepted deviation of the device clock rate from the host clock rate.
+	// Larger deviations are caused by jumps of the host clock, e.g. when NTP synchronises, and are ignored.
+	maxDrift = 1e-3
+)
+
+// point correlates a device timestamp with a host time, both in microseconds
+type point struct {
+	device int64
+	host   int64 // microseconds since the unix epoch
+}
+
+// Correlator maps device timestamps to UTC.
+// It is fed with the device timestamps of received samples and the host time when they were received.
+// Since samples are always received after they were timestamped, the sample with the lowest difference between
+// host time and device timestamp within a resample interval is taken as the correlation point.
+// The rate between the device and the host clock is derived from consecutive correlation points, which compensates
+// the drift of the device clock. When the device timestamps jump backwards, the device has been restarted,
+// and the correlation starts over.
+// A Correlator is thread safe.
+type Correlator struct {
+	ResampleInterval time.Duration // ResampleInterval is the interval to determine a new correlation point. 0 means 10 seconds.
+	RestartTolerance time.Duration // RestartTolerance is how far the device timestamps may go backwards without being taken as a restart. 0 means 1 second.
+
+	mu          sync.Mutex
+	anchor      point   // last correlation point
+	hasAnchor   bool    // whether anchor is valid
+	rate        float64 // host microseconds per device microsecond
+	window      point   // best correlation point of the current resample interval
+	windowStart time.Time
+	hasWindow   bool // whether window is valid
+	lastDevice  int64
+	restarts    int
+}
+
+// New creates a new Correlator
+func New() *Correlator {
+	return &Correlator{
+		rate: 1,
+	}
+}
+
+// Observe feeds the Correlator with the device timestamp of a sample and the host time when it was received.
+// It returns true if a restart of the device has been detected.
+func (c *Correlator) Observe(device int64, received time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	restarted := false
+	if (c.hasWindow || c.hasAnchor) && device < c.lastDevice-c.restartTolerance() {
+		c.reset()
+		c.restarts++
+		restarted = true
+	}
+	if device > c.lastDevice || restarted {
+		c.lastDevice = device
+	}
+
+	p := point{device: device, host: received.UnixMicro()}
+	if !c.hasWindow {
+		c.window = p
+		c.windowStart = received
+		c.hasWindow = true
+	} else if p.host-p.device < c.window.host-c.window.device {
+		c.window = p
+	}
+
+	if received.Sub(c.windowStart) >= c.resampleInterval() {
+		c.resample()
+	}
+	return restarted
+}
+
+// ToUTC returns the UTC time of the device timestamp.
+// It returns false if no sample has been observed since the start of the device.
+func (c *Correlator) ToUTC(device int64) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var host int64
+	switch {
+	case c.hasAnchor:
+		host = c.anchor.host + int64(float64(device-c.anchor.device)*c.rate)
+	case c.hasWindow:
+		// first resample interval, no drift compensation yet
+		host = c.window.host + device - c.window.device
+	default:
+		return time.Time{}, false
+	}
+	return time.UnixMicro(host).UTC(), true
+}
+
+// FormatUTC returns the UTC time of the device timestamp in ISO-8601 format, or an empty string if it is unknown
+func (c *Correlator) FormatUTC(device int64) string {
+	t, ok := c.ToUTC(device)
+	if !ok {
+		return ""
+	}
+	return t.Format(ISO8601)
+}
+
+// Drift returns the estimated deviation of the device clock rate from the host clock rate, e.g. 50e-6 if the device clock is 50ppm slow
+func (c *Correlator) Drift() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rate - 1
+}
+
+// Restarts returns the number of device restarts detected
+func (c *Correlator) Restarts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.restarts
+}
+
+// resample takes the best point of the current interval as new correlation point and starts a new interval
+func (c *Correlator) resample() {
+	if c.hasAnchor && c.window.device > c.anchor.device {
+		rate := float64(c.window.host-c.anchor.host) / float64(c.window.device-c.anchor.device)
+		// if the host clock jumped, the previous rate is kept
+		if rate > 1-maxDrift && rate < 1+maxDrift {
+			c.rate = rate
+		}
+	}
+	c.anchor = c.window
+	c.hasAnchor = true
+	c.hasWindow = false
+}
+
+func (c *Correlator) reset() {
+	c.hasAnchor = false
+	c.hasWindow = false
+	c.rate = 1
+}
+
+func (c *Correlator) resampleInterval() time.Duration {
+	if c.ResampleInterval == 0 {
+		return DefaultResampleInterval
+	}
+	return c.ResampleInterval
+}
+
+func (c *Correlator) restartTolerance() int64 {
+	if c.RestartTolerance == 0 {
+		return DefaultRestartTolerance.Microseconds()
+	}
+	return c.RestartTolerance.Microseconds()
+}
@@ -0,0 +1,63 @@
+package clockcorrelation_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ci4rail/velog/pkg/clockcorrelation"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2026, 10, 17, 8, 12, 3, 0, time.UTC)
+
+func TestToUTC(t *testing.T) {
+	c := clockcorrelation.New()
+
+	_, ok := c.ToUTC(1000)
+	assert.False(t, ok)
+
+	// received 3ms after the timestamp, then 1ms after it
+	c.Observe(1000000, start.Add(3*time.Millisecond))
+	c.Observe(1001000, start.Add(2*time.Millisecond))
+
+	utc, ok := c.ToUTC(1000000)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(time.Millisecond), utc)
+	assert.Equal(t, time.UTC, utc.Location())
+	assert.Equal(t, "2026-10-17T08:12:03.001000Z", c.FormatUTC(1000000))
+}
+
+func TestDriftCompensation(t *testing.T) {
+	c := clockcorrelation.New()
+	c.ResampleInterval = time.Second
+
+	// the device clock is 100ppm slow, each sample is received 500us after it was timestamped
+	for i := int64(0); i <= 100; i++ {
+		device := i * 100000
+		host := start.Add(time.Duration(i*100010) * time.Microsecond)
+		assert.False(t, c.Observe(device, host.Add(500*time.Microsecond)))
+	}
+	assert.InDelta(t, 100e-6, c.Drift(), 1e-6)
+
+	// one hour later, the error is much smaller than the accumulated drift of 360ms
+	utc, ok := c.ToUTC(3600 * 1000000)
+	assert.True(t, ok)
+	assert.WithinDuration(t, start.Add(3600360*time.Millisecond), utc, time.Millisecond)
+}
+
+func TestRestart(t *testing.T) {
+	c := clockcorrelation.New()
+
+	assert.False(t, c.Observe(5000000000, start))
+	// small jitter backwards is not a restart
+	assert.False(t, c.Observe(4999999000, start))
+	assert.Equal(t, 0, c.Restarts())
+
+	assert.True(t, c.Observe(2000, start.Add(time.Minute)))
+	assert.Equal(t, 1, c.Restarts())
+
+	utc, ok := c.ToUTC(2000)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(time.Minute), utc)
+}
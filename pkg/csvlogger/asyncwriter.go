@@ -0,0 +1,151 @@
+package csvlogger
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// RecordWriter is implemented by Writer and AsyncWriter
+type RecordWriter interface {
+	Write(record []string) error
+	WriteWithTimestamp(record []string, ts int64) error
+}
+
+// QueueFull is returned by AsyncWriter.Write if the record was dropped because the queue is full
+type QueueFull struct{}
+
+func (m *QueueFull) Error() string {
+	return "queue full"
+}
+
+// ErrorHandler is called from the writer goroutine of an AsyncWriter when the Writer returned an error for record.
+// It may write to w directly, e.g. to write the header again when a new file was started.
+// If it returns an error, the AsyncWriter stops writing and returns that error from subsequent calls to Write.
+type ErrorHandler func(w *Writer, record []string, err error) error
+
+// AsyncStats holds the queue statistics of an AsyncWriter
+type AsyncStats struct {
+	QueueSize      int    // capacity of the queue
+	QueueHighWater int64  // highest number of queued entries since the AsyncWriter was created
+	Dropped        uint64 // number of entries dropped since the AsyncWriter was created
+}
+
+// asyncEntry is a record to pass to the Writer, with the device timestamp of the record, if any
+type asyncEntry struct {
+	record       []string
+	ts           int64
+	hasTimestamp bool
+}
+
+// AsyncWriter decouples the producer of records from the disk.
+// Records are put into a bounded queue and written by a dedicated goroutine to the Writer, so Write never blocks.
+// If the queue is full, records are dropped and counted.
+type AsyncWriter struct {
+	w         *Writer
+	handler   ErrorHandler
+	queue     chan asyncEntry
+	done      chan struct{}
+	mu        sync.Mutex
+	err       error // error returned by the handler, stops writing
+	highWater int64
+	dropped   uint64
+}
+
+// NewAsyncWriter creates a new AsyncWriter with a queue for queueSize entries and starts its writer goroutine.
+// The AsyncWriter takes ownership of w, w must not be used by the caller anymore.
+func NewAsyncWriter(w *Writer, queueSize int, handler ErrorHandler) *AsyncWriter {
+	a := &AsyncWriter{
+		w:       w,
+		handler: handler,
+		queue:   make(chan asyncEntry, queueSize),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Write queues record for writing. The caller must not modify record afterwards.
+// If the queue is full, the record is dropped and a QueueFull error is returned.
+// If the writer goroutine has stopped due to an error, that error is returned.
+func (a *AsyncWriter) Write(record []string) error {
+	if err := a.error(); err != nil {
+		return err
+	}
+	return a.enqueue(asyncEntry{record: record})
+}
+
+// WriteWithTimestamp is Write for a record with the device timestamp ts, which is recorded in the manifest of the file that receives the record
+func (a *AsyncWriter) WriteWithTimestamp(record []string, ts int64) error {
+	if err := a.error(); err != nil {
+		return err
+	}
+	return a.enqueue(asyncEntry{record: record, ts: ts, hasTimestamp: true})
+}
+
+// Close writes all queued records and closes the Writer. Write must not be called after Close.
+func (a *AsyncWriter) Close() {
+	close(a.queue)
+	<-a.done
+}
+
+// Stats returns the queue statistics. It may be called from any goroutine.
+func (a *AsyncWriter) Stats() AsyncStats {
+	return AsyncStats{
+		QueueSize:      cap(a.queue),
+		QueueHighWater: atomic.LoadInt64(&a.highWater),
+		Dropped:        atomic.LoadUint64(&a.dropped),
+	}
+}
+
+// WriterStats returns the latency statistics of the Writer, see Writer.Stats()
+func (a *AsyncWriter) WriterStats() WriterStats {
+	return a.w.Stats()
+}
+
+func (a *AsyncWriter) enqueue(e asyncEntry) error {
+	select {
+	case a.queue <- e:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+		return &QueueFull{}
+	}
+	n := int64(len(a.queue))
+	for {
+		hw := atomic.LoadInt64(&a.highWater)
+		if n <= hw || atomic.CompareAndSwapInt64(&a.highWater, hw, n) {
+			break
+		}
+	}
+	return nil
+}
+
+func (a *AsyncWriter) error() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	defer a.w.Close()
+
+	for e := range a.queue {
+		if a.error() != nil {
+			// drain the queue
+			continue
+		}
+		err := a.w.Write(e.record)
+		if err != nil && a.handler != nil {
+			// the handler writes the record again, e.g. into the new file
+			err = a.handler(a.w, e.record, err)
+		}
+		if err == nil && e.hasTimestamp {
+			a.w.ObserveDeviceTimestamp(e.ts)
+		}
+		if err != nil {
+			a.mu.Lock()
+			a.err = err
+			a.mu.Unlock()
+		}
+	}
+}
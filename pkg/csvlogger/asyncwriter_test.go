@@ -0,0 +1,108 @@
+package csvlogger
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncWriter(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	w.MaxLines = 2
+	rotations := 0
+	a := NewAsyncWriter(w, 100, func(w *Writer, record []string, err error) error {
+		var fileSizeLimitReached *FileSizeLimitReached
+		if errors.As(err, &fileSizeLimitReached) {
+			rotations++
+			w.Write([]string{"header"})
+			return w.Write(record)
+		}
+		return err
+	})
+
+	assert.NoError(t, a.Write([]string{"header"}))
+	assert.NoError(t, a.Write([]string{"a"}))
+	assert.NoError(t, a.Write([]string{"b"}))
+	a.Close()
+
+	assert.Equal(t, 1, rotations)
+	data, err := os.ReadFile(testOutPath + "/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "header\na\n", string(data))
+	data, err = os.ReadFile(testOutPath + "/test0002.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "header\nb\n", string(data))
+
+	stats := a.Stats()
+	assert.Equal(t, 100, stats.QueueSize)
+	assert.Equal(t, uint64(0), stats.Dropped)
+	assert.GreaterOrEqual(t, stats.QueueHighWater, int64(1))
+}
+
+func TestAsyncWriterQueueFull(t *testing.T) {
+	a := &AsyncWriter{queue: make(chan asyncEntry, 2)}
+
+	var queueFull *QueueFull
+	assert.NoError(t, a.Write([]string{"a"}))
+	assert.NoError(t, a.Write([]string{"b"}))
+	assert.ErrorAs(t, a.Write([]string{"c"}), &queueFull)
+
+	stats := a.Stats()
+	assert.Equal(t, int64(2), stats.QueueHighWater)
+	assert.Equal(t, uint64(1), stats.Dropped)
+}
+
+func TestAsyncWriterTimestamps(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	w.MaxLines = 2
+	w.Manifest = &ManifestInfo{}
+	a := NewAsyncWriter(w, 3, func(w *Writer, record []string, err error) error {
+		w.Write([]string{"header"})
+		return w.Write(record)
+	})
+
+	// each record takes one entry of the queue, including its timestamp
+	assert.NoError(t, a.Write([]string{"header"}))
+	assert.NoError(t, a.WriteWithTimestamp([]string{"a"}, 100))
+	assert.NoError(t, a.WriteWithTimestamp([]string{"b"}, 200))
+	a.Close()
+	assert.Equal(t, uint64(0), a.Stats().Dropped)
+
+	// the timestamp of the record that was written again after the rotation belongs to the new file
+	m, err := readManifest(testOutPath + "/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), m.FirstDeviceTimestamp)
+	assert.Equal(t, int64(100), m.LastDeviceTimestamp)
+	m, err = readManifest(testOutPath + "/test0002.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200), m.FirstDeviceTimestamp)
+	assert.Equal(t, int64(200), m.LastDeviceTimestamp)
+}
+
+func TestAsyncWriterStopsOnError(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	w.MaxLines = 1
+	a := NewAsyncWriter(w, 100, func(w *Writer, record []string, err error) error {
+		return &DiskFull{}
+	})
+	assert.NoError(t, a.Write([]string{"a"}))
+	assert.NoError(t, a.Write([]string{"b"}))
+	a.Close()
+
+	var diskFull *DiskFull
+	assert.ErrorAs(t, a.Write([]string{"c"}), &diskFull)
+}
@@ -0,0 +1,169 @@
+package csvlogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Compressor gzips closed csv files in the background.
+// Each file is compressed into a temporary file, verified against the original and then renamed to <name>.gz. Finally the original is removed.
+// Files are processed one after another in a single goroutine which runs with low OS scheduling priority, where supported.
+// A Compressor may be shared between multiple Writers. It is thread safe.
+type Compressor struct {
+	Retention *Retention // Retention protects the file from deletion while it is compressed. May be nil.
+	queue     chan string
+	logger    zerolog.Logger
+}
+
+// NewCompressor creates a new Compressor. Call Run to start processing.
+func NewCompressor() *Compressor {
+	return &Compressor{
+		queue:  make(chan string, 1000),
+		logger: log.With().Str("component", "compressor").Logger(),
+	}
+}
+
+// Add queues the closed csv file name for compression.
+// If the queue is full, the file stays uncompressed and is picked up again when the next Writer with this Compressor starts.
+func (c *Compressor) Add(name string) {
+	select {
+	case c.queue <- name:
+	default:
+		c.logger.Warn().Msgf("compression queue full, leaving %s uncompressed", name)
+	}
+}
+
+// Run compresses the queued files until ctx is done
+func (c *Compressor) Run(ctx context.Context) {
+	lowerThreadPriority()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case name := <-c.queue:
+			err := c.compress(ctx, name)
+			if err != nil {
+				c.logger.Error().Msgf("compress %s: %s", name, err)
+			}
+		}
+	}
+}
+
+// compress gzips name into name.gz and removes name
+func (c *Compressor) compress(ctx context.Context, name string) error {
+	tmpName := name + ".gz.tmp"
+	defer os.Remove(tmpName)
+
+	if c.Retention != nil {
+		// if the retention deleted the file while it is read, the deleted file would reappear compressed
+		c.Retention.activate(name)
+		defer c.Retention.deactivate(name)
+	}
+
+	in, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		// already compressed or deleted by the retention
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	srcHash := sha256.New()
+	gzHashing := newHashingWriter(out)
+	gz := gzip.NewWriter(gzHashing)
+	if err := copyWithContext(ctx, gz, io.TeeReader(in, srcHash)); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+
+	// verify the compressed file
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	gzHash, err := gunzipHash(out)
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", tmpName, err)
+	}
+	if !bytes.Equal(gzHash.Sum(nil), srcHash.Sum(nil)) {
+		return fmt.Errorf("verify %s: content differs from original", tmpName)
+	}
+
+	if err := os.Rename(tmpName, name+".gz"); err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// the manifest, if any, must now describe the compressed file
+	if m, err := readManifest(name); err == nil {
+		m.File = filepath.Base(name + ".gz")
+		m.Bytes = gzHashing.n
+		m.SHA256 = hex.EncodeToString(gzHashing.h.Sum(nil))
+		if err := writeManifest(name, m); err != nil {
+			return err
+		}
+	}
+	c.logger.Info().Msgf("compressed %s", name)
+	return nil
+}
+
+// gunzipHash returns the SHA-256 hash of the decompressed content of r
+func gunzipHash(r io.Reader) (hash.Hash, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, zr); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// copyWithContext copies src to dst, but aborts if ctx is done
+func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader) error {
+	buf := make([]byte, 64*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package csvlogger
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressor(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	c := NewCompressor()
+	err := os.WriteFile(testOutPath+"/test0001.csv", []byte("a,b\nc,d\n"), 0644)
+	assert.NoError(t, err)
+
+	err = c.compress(context.Background(), testOutPath+"/test0001.csv")
+	assert.NoError(t, err)
+	assert.NoFileExists(t, testOutPath+"/test0001.csv")
+	assert.NoFileExists(t, testOutPath+"/test0001.csv.gz.tmp")
+
+	data, err := readGzipFile(t, testOutPath+"/test0001.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "a,b\nc,d\n", data)
+
+	// file vanished in the meantime
+	err = c.compress(context.Background(), testOutPath+"/test0002.csv")
+	assert.NoError(t, err)
+}
+
+func TestCompressorRetention(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	r := NewRetention(testOutPath, 0, 1)
+	c := NewCompressor()
+	c.Retention = r
+	err := os.WriteFile(testOutPath+"/test0001.csv", []byte("a,b\nc,d\n"), 0644)
+	assert.NoError(t, err)
+
+	// the file is protected only while it is compressed
+	err = c.compress(context.Background(), testOutPath+"/test0001.csv")
+	assert.NoError(t, err)
+	assert.Len(t, r.active, 0)
+
+	// once compressed, the retention may delete the compressed file
+	freed, err := r.Enforce()
+	assert.NoError(t, err)
+	assert.Greater(t, freed, int64(0))
+	assert.NoFileExists(t, testOutPath+"/test0001.csv.gz")
+}
+
+func TestWriterWithCompressor(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	// leftover from a previous run
+	os.WriteFile(testOutPath+"/test0001.csv", []byte("x\n"), 0644)
+	os.WriteFile(testOutPath+"/other0001.csv", []byte("x\n"), 0644)
+
+	c := NewCompressor()
+	w := NewWriter(testOutPath, "test")
+	w.Compressor = c
+
+	assert.NoError(t, w.Write([]string{"a"}))
+	assert.Equal(t, testOutPath+"/test0001.csv", <-c.queue)
+	assert.Len(t, c.queue, 0)
+
+	w.Close()
+	assert.Equal(t, testOutPath+"/test0002.csv", <-c.queue)
+	assert.Len(t, c.queue, 0)
+}
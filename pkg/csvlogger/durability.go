@@ -0,0 +1,86 @@
+package csvlogger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultFlushInterval is used if Durability.FlushInterval is not set
+const defaultFlushInterval = 2 * time.Second
+
+// Durability controls when the data of a Writer is handed over to the OS and when it is synced to the disk.
+// Syncing more often loses less data on power loss, but costs write latency and wears SD cards.
+type Durability struct {
+	FlushInterval     time.Duration // FlushInterval is the interval to write buffered data to the OS. 0 means 2 seconds.
+	Fsync             bool          // Fsync syncs the file to disk after each flush.
+	FsyncDir          bool          // FsyncDir syncs the directory after a file has been created or finalised.
+	FsyncEveryRecords int           // FsyncEveryRecords flushes and syncs the file after every n records. 0 disables it.
+}
+
+// LatencyStats holds latency statistics of one kind of operation
+type LatencyStats struct {
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Mean returns the mean latency
+func (s LatencyStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+func (s LatencyStats) String() string {
+	return fmt.Sprintf("n=%d mean=%s max=%s", s.Count, s.Mean(), s.Max)
+}
+
+func (s *LatencyStats) add(d time.Duration) {
+	s.Count++
+	s.Total += d
+	if d > s.Max {
+		s.Max = d
+	}
+}
+
+// WriterStats holds the latency statistics of a Writer
+type WriterStats struct {
+	Writes  LatencyStats // calls to Write, including flushes and syncs
+	Flushes LatencyStats // writes of buffered data to the OS
+	Syncs   LatencyStats // fsync of the file
+}
+
+// writerStats is a thread safe WriterStats, so that the statistics can be read from another goroutine
+type writerStats struct {
+	sync.Mutex
+	WriterStats
+}
+
+func (s *writerStats) add(stats *LatencyStats, start time.Time) {
+	d := time.Since(start)
+	s.Lock()
+	stats.add(d)
+	s.Unlock()
+}
+
+// take returns the statistics and resets them
+func (s *writerStats) take() WriterStats {
+	s.Lock()
+	defer s.Unlock()
+	stats := s.WriterStats
+	s.WriterStats = WriterStats{}
+	return stats
+}
+
+// syncDir syncs the directory dir, so that created and renamed files survive a power loss
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
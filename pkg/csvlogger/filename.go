@@ -0,0 +1,114 @@
+package csvlogger
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// placeholder matches a placeholder in a file name template, e.g. {index}
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// fileNameTemplate expands and matches the file names of a Writer.
+// The template may contain the placeholders
+//   - {index}: the file index, incremented for each new file, e.g. 0042
+//   - {date}: the local date when the file was created, e.g. 20221227
+//   - {time}: the local time when the file was created, e.g. 203231
+//   - any other {name}, which is replaced by the value with that name. {host} defaults to the hostname.
+type fileNameTemplate struct {
+	template string
+	values   map[string]string
+	pattern  *regexp.Regexp // matches file names of the template, the first group is the index
+}
+
+// newFileNameTemplate creates the template for fileName, which is either a template or a plain prefix like "mvb".
+// A plain prefix is treated as "<prefix>{index}.csv". If the template has no {index} placeholder, it is appended.
+func newFileNameTemplate(fileName string, values map[string]string) *fileNameTemplate {
+	t := strings.TrimSuffix(fileName, ".csv")
+	if !strings.Contains(t, "{index}") {
+		t += "{index}"
+	}
+	t += ".csv"
+
+	v := make(map[string]string)
+	if host, err := os.Hostname(); err == nil {
+		v["host"] = host
+	}
+	for key, value := range values {
+		v[key] = value
+	}
+	for key, value := range v {
+		// values must not create sub directories
+		v[key] = strings.ReplaceAll(value, string(os.PathSeparator), "_")
+	}
+
+	ft := &fileNameTemplate{
+		template: t,
+		values:   v,
+	}
+	ft.pattern = regexp.MustCompile("^" + ft.regexp() + `(\.gz)?(` + regexp.QuoteMeta(partialSuffix) + ")?$")
+	return ft
+}
+
+// expand returns the file name for index, for a file created at now
+func (t *fileNameTemplate) expand(index int, now time.Time) string {
+	return placeholder.ReplaceAllStringFunc(t.template, func(p string) string {
+		switch key := p[1 : len(p)-1]; key {
+		case "index":
+			return fmt.Sprintf("%04d", index)
+		case "date":
+			return now.Format("20060102")
+		case "time":
+			return now.Format("150405")
+		default:
+			if value, ok := t.values[key]; ok {
+				return value
+			}
+			return p
+		}
+	})
+}
+
+// index returns the index of name (without path), if name belongs to the template
+func (t *fileNameTemplate) index(name string) (int, bool) {
+	m := t.pattern.FindStringSubmatch(name)
+	if m == nil {
+		return 0, false
+	}
+	i, err := strconv.Atoi(m[1])
+	return i, err == nil
+}
+
+// regexp returns the regular expression for the template. The first {index} is captured.
+func (t *fileNameTemplate) regexp() string {
+	var re strings.Builder
+	indexCaptured := false
+	last := 0
+	for _, loc := range placeholder.FindAllStringSubmatchIndex(t.template, -1) {
+		re.WriteString(regexp.QuoteMeta(t.template[last:loc[0]]))
+		last = loc[1]
+
+		switch key := t.template[loc[2]:loc[3]]; key {
+		case "index":
+			if indexCaptured {
+				re.WriteString(`\d+`)
+			} else {
+				re.WriteString(`(\d+)`)
+				indexCaptured = true
+			}
+		case "date", "time":
+			re.WriteString(`\d+`)
+		default:
+			if value, ok := t.values[key]; ok {
+				re.WriteString(regexp.QuoteMeta(value))
+			} else {
+				re.WriteString(regexp.QuoteMeta(t.template[loc[0]:loc[1]]))
+			}
+		}
+	}
+	re.WriteString(regexp.QuoteMeta(t.template[last:]))
+	return re.String()
+}
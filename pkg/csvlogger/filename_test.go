@@ -0,0 +1,67 @@
+package csvlogger
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileNameTemplate(t *testing.T) {
+	now := time.Date(2022, 12, 27, 20, 32, 31, 0, time.Local)
+
+	ft := newFileNameTemplate("{vehicle}_{bus}_{date}_{time}_{index}.csv", map[string]string{
+		"vehicle": "ICE4/0815",
+		"bus":     "mvb",
+	})
+	name := ft.expand(42, now)
+	assert.Equal(t, "ICE4_0815_mvb_20221227_203231_0042.csv", name)
+
+	i, ok := ft.index(name)
+	assert.True(t, ok)
+	assert.Equal(t, 42, i)
+	i, ok = ft.index("ICE4_0815_mvb_20221228_000000_0043.csv.gz.partial")
+	assert.True(t, ok)
+	assert.Equal(t, 43, i)
+
+	_, ok = ft.index("ICE4_0815_can_20221227_203231_0042.csv")
+	assert.False(t, ok)
+	_, ok = ft.index("ICE4_0815_mvb_20221227_203231_0042.json")
+	assert.False(t, ok)
+
+	// plain prefix
+	ft = newFileNameTemplate("mvb", nil)
+	assert.Equal(t, "mvb0001.csv", ft.expand(1, now))
+	_, ok = ft.index("mvbraw0001.csv")
+	assert.False(t, ok)
+
+	// no index and no extension
+	ft = newFileNameTemplate("{host}_{date}", nil)
+	host, _ := os.Hostname()
+	assert.Equal(t, host+"_202212270003.csv", ft.expand(3, now))
+
+	// unknown placeholders are kept
+	ft = newFileNameTemplate("{unknown}{index}", nil)
+	assert.Equal(t, "{unknown}0003.csv", ft.expand(3, now))
+	i, ok = ft.index("{unknown}0003.csv")
+	assert.True(t, ok)
+	assert.Equal(t, 3, i)
+}
+
+func TestNewFileNameWithTemplate(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	os.Create(testOutPath + "/v1_mvb_20221226_0007.csv.gz")
+	os.Create(testOutPath + "/v1_can_20221226_0009.csv")
+
+	w := NewWriter(testOutPath, "{vehicle}_{bus}_{date}_{index}.csv")
+	w.TemplateValues = map[string]string{"vehicle": "v1", "bus": "mvb"}
+	w.now = func() time.Time { return time.Date(2022, 12, 27, 8, 0, 0, 0, time.Local) }
+
+	name, err := w.nextFileName()
+	assert.NoError(t, err)
+	assert.Equal(t, testOutPath+"/v1_mvb_20221227_0008.csv", name)
+}
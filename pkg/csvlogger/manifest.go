@@ -0,0 +1,103 @@
+package csvlogger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ManifestInfo holds the manifest fields that are provided by the user of a Writer
+type ManifestInfo struct {
+	Version    string // Version of the application that wrote the file
+	Device     string // Device that delivered the data
+	ConfigHash string // ConfigHash identifies the configuration that was used to write the file, see HashConfig()
+}
+
+// Manifest describes a finished log file.
+// It is written as JSON sidecar file next to the log file, e.g. mvb0001.json for mvb0001.csv.
+type Manifest struct {
+	File                 string    `json:"file"`
+	Created              time.Time `json:"created"`
+	Closed               time.Time `json:"closed"`
+	FirstDeviceTimestamp int64     `json:"firstDeviceTimestamp,omitempty"` // lowest device timestamp in the file
+	LastDeviceTimestamp  int64     `json:"lastDeviceTimestamp,omitempty"`  // highest device timestamp in the file
+	Lines                int       `json:"lines"`
+	Bytes                int64     `json:"bytes"` // size of the file
+	SHA256               string    `json:"sha256"`
+	Version              string    `json:"version"`
+	Device               string    `json:"device"`
+	ConfigHash           string    `json:"configHash"`
+	Recovered            bool      `json:"recovered,omitempty"` // the file was recovered after a power loss, the device timestamps are unknown
+}
+
+// hashingWriter passes all writes to w and maintains the SHA-256 and size of the written data
+type hashingWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+func newHashingWriter(w io.Writer) *hashingWriter {
+	return &hashingWriter{w: w, h: sha256.New()}
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.h.Write(p[:n])
+	hw.n += int64(n)
+	return n, err
+}
+
+// HashConfig returns the hex encoded SHA-256 of the JSON representation of cfg
+func HashConfig(cfg interface{}) (string, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// manifestName returns the manifest file name for the log file name
+func manifestName(name string) string {
+	name = strings.TrimSuffix(name, ".gz")
+	return strings.TrimSuffix(name, ".csv") + ".json"
+}
+
+func writeManifest(name string, m *Manifest) error {
+	return writeManifestFile(manifestName(name), m)
+}
+
+// writePartialManifest writes the manifest of a file that is still written, so that Recover can complete it after a power loss
+func writePartialManifest(name string, m *Manifest) error {
+	return writeManifestFile(manifestName(name)+partialSuffix, m)
+}
+
+func writeManifestFile(fileName string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, data, 0644)
+}
+
+func readManifest(name string) (*Manifest, error) {
+	return readManifestFile(manifestName(name))
+}
+
+func readManifestFile(fileName string) (*Manifest, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
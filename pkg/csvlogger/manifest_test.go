@@ -0,0 +1,70 @@
+package csvlogger
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fileSHA256(t *testing.T, name string) string {
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestManifest(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	w.Manifest = &ManifestInfo{Version: "1.2.3", Device: "dev", ConfigHash: "abc"}
+
+	assert.NoError(t, w.Write([]string{"header"}))
+	assert.FileExists(t, testOutPath+"/test0001.json.partial")
+	assert.NoError(t, w.Write([]string{"a", "b"}))
+	w.ObserveDeviceTimestamp(200)
+	assert.NoError(t, w.Write([]string{"c", "d"}))
+	w.ObserveDeviceTimestamp(100)
+	w.Close()
+
+	m, err := readManifest(testOutPath + "/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "test0001.csv", m.File)
+	assert.Equal(t, 3, m.Lines)
+	assert.Equal(t, int64(15), m.Bytes)
+	assert.Equal(t, int64(100), m.FirstDeviceTimestamp)
+	assert.Equal(t, int64(200), m.LastDeviceTimestamp)
+	assert.Equal(t, fileSHA256(t, testOutPath+"/test0001.csv"), m.SHA256)
+	assert.Equal(t, "1.2.3", m.Version)
+	assert.Equal(t, "dev", m.Device)
+	assert.Equal(t, "abc", m.ConfigHash)
+	assert.False(t, m.Closed.Before(m.Created))
+	assert.False(t, m.Recovered)
+	assert.NoFileExists(t, testOutPath+"/test0001.json.partial")
+
+	// background compression updates the manifest
+	c := NewCompressor()
+	assert.NoError(t, c.compress(context.Background(), testOutPath+"/test0001.csv"))
+	m, err = readManifest(testOutPath + "/test0001.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "test0001.csv.gz", m.File)
+	assert.Equal(t, fileSHA256(t, testOutPath+"/test0001.csv.gz"), m.SHA256)
+	assert.Equal(t, 3, m.Lines)
+}
+
+func TestHashConfig(t *testing.T) {
+	type config struct{ A, B int }
+
+	h1, err := HashConfig(config{1, 2})
+	assert.NoError(t, err)
+	h2, err := HashConfig(config{1, 3})
+	assert.NoError(t, err)
+	assert.Len(t, h1, 64)
+	assert.NotEqual(t, h1, h2)
+}
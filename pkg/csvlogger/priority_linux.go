@@ -0,0 +1,12 @@
+package csvlogger
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// lowerThreadPriority locks the calling goroutine to its OS thread and sets the nice value of that thread to the lowest priority
+func lowerThreadPriority() {
+	runtime.LockOSThread()
+	_ = syscall.Setpriority(syscall.PRIO_PROCESS, syscall.Gettid(), 19)
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package csvlogger
+
+// lowerThreadPriority is not supported on this platform
+func lowerThreadPriority() {}
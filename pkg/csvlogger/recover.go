@@ -0,0 +1,218 @@
+package csvlogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// partialSuffix is appended to the name of a file while it is written. It is removed when the file is closed.
+const partialSuffix = ".partial"
+
+// Recover finalises the partial files in dir and its sub directories that have been left over, e.g. after a power loss.
+// Each file is truncated to its last complete record and renamed to its final name.
+// Temporary files of an interrupted compression are deleted, the original files are still there and are compressed again.
+// Recover must be called before any Writer writes to dir and before the Compressor runs.
+func Recover(dir string) error {
+	logger := log.With().Str("component", "csvlogger").Logger()
+
+	var firstErr error
+	err := filepath.WalkDir(dir, func(name string, file os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file.Type().IsRegular() && isTempFile(file.Name()) {
+			if err := os.Remove(name); err != nil {
+				logger.Error().Msgf("could not delete %s: %s", name, err)
+			} else {
+				logger.Warn().Msgf("deleted %s of an interrupted compression", name)
+			}
+			return nil
+		}
+		if !file.Type().IsRegular() || !strings.HasSuffix(file.Name(), partialSuffix) {
+			return nil
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil
+		}
+		var n int64
+		if strings.HasSuffix(file.Name(), ".gz"+partialSuffix) {
+			n, err = recoverGzip(name)
+		} else {
+			n, err = recoverPlain(name)
+		}
+		if err != nil {
+			logger.Error().Msgf("could not recover %s: %s", name, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("could not recover %s: %w", name, err)
+			}
+			return nil
+		}
+		logger.Warn().Msgf("recovered %s, kept %d bytes", name, n)
+		if err := recoverManifest(strings.TrimSuffix(name, partialSuffix), n > 0, info.ModTime()); err != nil {
+			logger.Error().Msgf("could not recover manifest of %s: %s", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// recoverManifest completes the partial manifest of the recovered file name, if manifests are written.
+// The file was last written at lastWrite. kept is false if the file has been removed, because it did not contain any complete record.
+func recoverManifest(name string, kept bool, lastWrite time.Time) error {
+	partialName := manifestName(name) + partialSuffix
+	m, err := readManifestFile(partialName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !kept {
+		return os.Remove(partialName)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	m.Bytes = int64(len(data))
+	m.SHA256 = hex.EncodeToString(sum[:])
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return err
+		}
+	}
+	m.Lines = bytes.Count(data, []byte{'\n'})
+	m.Closed = lastWrite
+	if m.Closed.Before(m.Created) {
+		// the file system clock may be coarser than the clock of the Writer
+		m.Closed = m.Created
+	}
+	m.Recovered = true
+	if err := writeManifest(name, m); err != nil {
+		return err
+	}
+	return os.Remove(partialName)
+}
+
+// isTempFile checks whether the file name belongs to a temporary file of the Compressor or of recoverGzip
+func isTempFile(name string) bool {
+	return strings.HasSuffix(name, ".csv.gz.tmp") || strings.HasSuffix(name, ".csv.gz"+partialSuffix+".tmp")
+}
+
+// recoverPlain truncates the uncompressed partial file name after its last complete record and finalises it.
+// It returns the number of bytes kept.
+func recoverPlain(name string) (int64, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, err := completeLength(f)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.Truncate(n); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return n, finalise(name, n)
+}
+
+// recoverGzip decompresses the compressed partial file name up to the point where the data is unreadable,
+// and writes the complete records into a new, properly terminated gzip file.
+// It returns the number of uncompressed bytes kept.
+func recoverGzip(name string) (int64, error) {
+	var data []byte
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err == nil {
+		// the data up to the last flush is readable, the rest is lost anyway
+		data, _ = io.ReadAll(zr)
+	}
+	f.Close()
+
+	n := int64(bytes.LastIndexByte(data, '\n') + 1)
+
+	tmpName := name + ".tmp"
+	out, err := os.Create(tmpName)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpName)
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	if _, err := zw.Write(data[:n]); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpName, name); err != nil {
+		return 0, err
+	}
+	return n, finalise(name, n)
+}
+
+// completeLength returns the length of f up to and including the last newline.
+// The file is scanned backwards, since the last newline is usually close to the end.
+func completeLength(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 64*1024)
+	end := info.Size()
+	for end > 0 {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// finalise renames the partial file name to its final name, or removes it if it does not contain any complete record
+func finalise(name string, n int64) error {
+	if n == 0 {
+		return os.Remove(name)
+	}
+	return os.Rename(name, strings.TrimSuffix(name, partialSuffix))
+}
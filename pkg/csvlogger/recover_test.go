@@ -0,0 +1,127 @@
+package csvlogger
+
+import (
+	"compress/gzip"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartialFile(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	assert.NoError(t, w.Write([]string{"a"}))
+	assert.FileExists(t, testOutPath+"/test0001.csv.partial")
+	assert.NoFileExists(t, testOutPath+"/test0001.csv")
+
+	w.Close()
+	assert.NoFileExists(t, testOutPath+"/test0001.csv.partial")
+	assert.FileExists(t, testOutPath+"/test0001.csv")
+}
+
+func TestRecover(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	// half written line
+	os.WriteFile(testOutPath+"/test0001.csv.partial", []byte("header\na,b\nc,"), 0644)
+	// no complete line at all
+	os.WriteFile(testOutPath+"/test0002.csv.partial", []byte("hea"), 0644)
+	// flushed, but unterminated gzip stream
+	f, _ := os.Create(testOutPath + "/test0003.csv.gz.partial")
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte("header\nx,y\nz"))
+	zw.Flush()
+	f.Close()
+
+	assert.NoError(t, Recover(testOutPath))
+
+	data, err := os.ReadFile(testOutPath + "/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "header\na,b\n", string(data))
+	assert.NoFileExists(t, testOutPath+"/test0001.csv.partial")
+
+	assert.NoFileExists(t, testOutPath+"/test0002.csv")
+	assert.NoFileExists(t, testOutPath+"/test0002.csv.partial")
+
+	s, err := readGzipFile(t, testOutPath+"/test0003.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "header\nx,y\n", s)
+	assert.NoFileExists(t, testOutPath+"/test0003.csv.gz.partial")
+}
+
+func TestRecoverSubDirectory(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.MkdirAll(testOutPath+"/sess0001", 0777)
+
+	os.WriteFile(testOutPath+"/sess0001/test0001.csv.partial", []byte("header\na,b\nc,"), 0644)
+
+	assert.NoError(t, Recover(testOutPath))
+
+	data, err := os.ReadFile(testOutPath + "/sess0001/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "header\na,b\n", string(data))
+}
+
+func TestRecoverCompressionLeftovers(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.MkdirAll(testOutPath+"/sess0001", 0777)
+
+	// power loss while compressing in the background and while recovering a compressed file
+	os.WriteFile(testOutPath+"/test0001.csv", []byte("header\na,b\n"), 0644)
+	os.WriteFile(testOutPath+"/test0001.csv.gz.tmp", []byte("garbage"), 0644)
+	os.WriteFile(testOutPath+"/sess0001/test0002.csv.gz.partial.tmp", []byte("garbage"), 0644)
+	os.WriteFile(testOutPath+"/other.tmp", []byte("keep"), 0644)
+
+	assert.NoError(t, Recover(testOutPath))
+
+	assert.NoFileExists(t, testOutPath+"/test0001.csv.gz.tmp")
+	assert.NoFileExists(t, testOutPath+"/sess0001/test0002.csv.gz.partial.tmp")
+	assert.FileExists(t, testOutPath+"/test0001.csv")
+	assert.FileExists(t, testOutPath+"/other.tmp")
+}
+
+func TestRecoverManifest(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	w.Manifest = &ManifestInfo{Version: "1.2.3", Device: "dev", ConfigHash: "abc"}
+	assert.NoError(t, w.Write([]string{"header"}))
+	assert.NoError(t, w.Write([]string{"a", "b"}))
+	w.writer.Flush()
+	// power loss, the writer is never closed
+	w.currentFile.Close()
+	assert.FileExists(t, testOutPath+"/test0001.json.partial")
+	f, _ := os.OpenFile(testOutPath+"/test0001.csv.partial", os.O_APPEND|os.O_WRONLY, 0)
+	f.Write([]byte("c,"))
+	f.Close()
+
+	// partial manifest of a file without any complete record
+	os.WriteFile(testOutPath+"/test0002.csv.partial", []byte("hea"), 0644)
+	os.WriteFile(testOutPath+"/test0002.json.partial", []byte("{}"), 0644)
+
+	assert.NoError(t, Recover(testOutPath))
+
+	assert.NoFileExists(t, testOutPath+"/test0001.json.partial")
+	m, err := readManifest(testOutPath + "/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "test0001.csv", m.File)
+	assert.Equal(t, 2, m.Lines)
+	assert.Equal(t, int64(11), m.Bytes)
+	assert.Equal(t, fileSHA256(t, testOutPath+"/test0001.csv"), m.SHA256)
+	assert.Equal(t, "1.2.3", m.Version)
+	assert.True(t, m.Recovered)
+	assert.False(t, m.Closed.Before(m.Created))
+
+	assert.NoFileExists(t, testOutPath+"/test0002.json.partial")
+	assert.NoFileExists(t, testOutPath+"/test0002.json")
+}
@@ -0,0 +1,164 @@
+package csvlogger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Retention deletes the oldest log files in a directory and its sub directories, regardless of their prefix, to keep a reserve of free disk space
+// and to limit the total size of all log files. Files that are currently written by a Writer are never deleted.
+// A sub directory is deleted together with its remaining files, e.g. a session manifest, once its last log file has been deleted,
+// unless a Writer writes to it.
+// A Retention may be shared between multiple Writers. It is thread safe.
+type Retention struct {
+	MinFreeSpace int64 // MinFreeSpace is the free space in bytes to keep on the file system. 0 means no limit.
+	MaxTotalSize int64 // MaxTotalSize is the maximum total size in bytes of all log files in the directory. 0 means no limit.
+	dir          string
+	mu           sync.Mutex
+	active       map[string]bool // files currently written by a Writer, and the directories the Writers write to
+	logger       zerolog.Logger
+	freeSpace    func(dir string) (int64, error)
+}
+
+type retentionFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// NewRetention creates a new Retention for the log files in dir
+func NewRetention(dir string, minFreeSpace int64, maxTotalSize int64) *Retention {
+	return &Retention{
+		MinFreeSpace: minFreeSpace,
+		MaxTotalSize: maxTotalSize,
+		dir:          dir,
+		active:       make(map[string]bool),
+		logger:       log.With().Str("component", "retention").Logger(),
+		freeSpace:    freeSpace,
+	}
+}
+
+// Enforce deletes the oldest log files until the free space and total size limits are met again.
+// It returns the number of bytes freed.
+func (r *Retention) Enforce() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total int64
+	var candidates []retentionFile
+
+	err := filepath.WalkDir(r.dir, func(name string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if name == r.dir {
+				return err
+			}
+			// e.g. a session directory deleted meanwhile
+			return nil
+		}
+		if !entry.Type().IsRegular() || !isLogFile(entry.Name()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		if !r.active[name] {
+			candidates = append(candidates, retentionFile{name: name, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].modTime.Equal(candidates[j].modTime) {
+			return candidates[i].name < candidates[j].name
+		}
+		return candidates[i].modTime.Before(candidates[j].modTime)
+	})
+
+	free := int64(0)
+	if r.MinFreeSpace > 0 {
+		free, err = r.freeSpace(r.dir)
+		if err != nil {
+			return 0, fmt.Errorf("could not determine free space of %s: %w", r.dir, err)
+		}
+	}
+
+	var freed int64
+	for _, f := range candidates {
+		if (r.MinFreeSpace == 0 || free >= r.MinFreeSpace) && (r.MaxTotalSize == 0 || total <= r.MaxTotalSize) {
+			break
+		}
+		if err := os.Remove(f.name); err != nil {
+			r.logger.Error().Msgf("could not delete %s: %s", f.name, err)
+			continue
+		}
+		r.logger.Warn().Msgf("deleted %s (%d bytes) to free space", f.name, f.size)
+		os.Remove(manifestName(f.name))
+		if dir := filepath.Dir(f.name); dir != filepath.Clean(r.dir) && !r.active[dir] && !containsLogFile(dir) {
+			// remove the sub directory, e.g. a session directory, with its remaining files once its last log file is gone
+			if err := os.RemoveAll(dir); err != nil {
+				r.logger.Error().Msgf("could not delete %s: %s", dir, err)
+			} else {
+				r.logger.Warn().Msgf("deleted %s", dir)
+			}
+		}
+		free += f.size
+		total -= f.size
+		freed += f.size
+	}
+	return freed, nil
+}
+
+// containsLogFile checks whether the directory or one of its sub directories contains a log file
+func containsLogFile(dir string) bool {
+	found := false
+	filepath.WalkDir(dir, func(name string, entry os.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() && isLogFile(entry.Name()) {
+			found = true
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return found
+}
+
+// activate protects the file from deletion while it is written, or the directory while a Writer writes to it
+func (r *Retention) activate(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active[filepath.Clean(name)] = true
+}
+
+// deactivate releases the file for deletion
+func (r *Retention) deactivate(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.active, filepath.Clean(name))
+}
+
+// isLogFile checks whether the file name belongs to a log file that may be deleted by the Retention
+func isLogFile(name string) bool {
+	name = strings.TrimSuffix(name, partialSuffix)
+	return strings.HasSuffix(name, ".csv") || strings.HasSuffix(name, ".csv.gz")
+}
+
+// freeSpace returns the number of bytes available to unprivileged users on the file system of dir
+func freeSpace(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,107 @@
+package csvlogger
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createRetentionTestFile(t *testing.T, name string, size int, age time.Duration) {
+	err := os.WriteFile(testOutPath+"/"+name, make([]byte, size), 0644)
+	assert.NoError(t, err)
+	mt := time.Now().Add(-age)
+	assert.NoError(t, os.Chtimes(testOutPath+"/"+name, mt, mt))
+}
+
+func TestRetentionMaxTotalSize(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	createRetentionTestFile(t, "can0001.csv", 100, 3*time.Hour)
+	createRetentionTestFile(t, "mvb0001.csv", 100, 2*time.Hour)
+	createRetentionTestFile(t, "mvb0002.csv", 100, time.Hour)
+	createRetentionTestFile(t, "other.txt", 1000, 4*time.Hour)
+	createRetentionTestFile(t, "can0001.json", 10, 3*time.Hour)
+
+	r := NewRetention(testOutPath, 0, 150)
+	freed, err := r.Enforce()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200), freed)
+
+	assert.NoFileExists(t, testOutPath+"/can0001.csv")
+	assert.NoFileExists(t, testOutPath+"/can0001.json")
+	assert.NoFileExists(t, testOutPath+"/mvb0001.csv")
+	assert.FileExists(t, testOutPath+"/mvb0002.csv")
+	assert.FileExists(t, testOutPath+"/other.txt")
+}
+
+func TestRetentionMinFreeSpace(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	createRetentionTestFile(t, "can0001.csv", 100, 3*time.Hour)
+	createRetentionTestFile(t, "mvb0001.csv", 100, 2*time.Hour)
+
+	r := NewRetention(testOutPath, 1000, 0)
+	r.freeSpace = func(dir string) (int64, error) { return 950, nil }
+
+	// the oldest file is active and must not be deleted
+	r.activate(testOutPath + "/can0001.csv")
+	freed, err := r.Enforce()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), freed)
+	assert.FileExists(t, testOutPath+"/can0001.csv")
+	assert.NoFileExists(t, testOutPath+"/mvb0001.csv")
+
+	// nothing left to delete
+	freed, err = r.Enforce()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), freed)
+}
+
+func TestRetentionSubDirectories(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+	os.Mkdir(testOutPath+"/sess0001", 0777)
+	os.Mkdir(testOutPath+"/sess0002", 0777)
+
+	createRetentionTestFile(t, "sess0001/mvb0001.csv", 100, 3*time.Hour)
+	createRetentionTestFile(t, "sess0001/session.json", 10, 3*time.Hour)
+	createRetentionTestFile(t, "sess0002/session.json", 10, 2*time.Hour)
+	createRetentionTestFile(t, "sess0002/mvb0001.csv", 100, 2*time.Hour)
+	createRetentionTestFile(t, "sess0002/mvb0002.csv", 100, time.Hour)
+
+	r := NewRetention(testOutPath, 0, 250)
+	freed, err := r.Enforce()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), freed)
+
+	// the session directory without log files is removed as well
+	assert.NoDirExists(t, testOutPath+"/sess0001")
+	assert.FileExists(t, testOutPath+"/sess0002/mvb0001.csv")
+	assert.FileExists(t, testOutPath+"/sess0002/mvb0002.csv")
+	assert.FileExists(t, testOutPath+"/sess0002/session.json")
+}
+
+func TestRetentionActiveDirectory(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+	os.Mkdir(testOutPath+"/sess0001", 0777)
+
+	createRetentionTestFile(t, "sess0001/mvb0001.csv", 100, 3*time.Hour)
+	createRetentionTestFile(t, "sess0001/session.json", 10, 3*time.Hour)
+
+	// a Writer is about to create its next file in the directory
+	r := NewRetention(testOutPath, 0, 50)
+	r.activate(testOutPath + "/sess0001")
+	freed, err := r.Enforce()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), freed)
+	assert.FileExists(t, testOutPath+"/sess0001/session.json")
+}
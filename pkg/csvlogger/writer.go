@@ -1,13 +1,19 @@
 // Package csvlogger provides a simple CSV logger for Go.
 // It is intented to store csv data in a file until the maximum file size is reached. Then a new file is created.
+// The maximum file size is either given by the file system (e.g. 4GB on vfat) or by the MaxFileSize and MaxLines settings of the Writer.
 package csvlogger
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"encoding/csv"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -25,6 +31,13 @@ func (m *FileSizeLimitReached) Error() string {
 	return "file size limit reached"
 }
 
+// RotationTimeReached is returned if the current file has reached its wall-clock rotation boundary
+type RotationTimeReached struct{}
+
+func (m *RotationTimeReached) Error() string {
+	return "rotation time reached"
+}
+
 // DiskFull is returned if the disk is full
 type DiskFull struct{}
 
@@ -34,42 +47,99 @@ func (m *DiskFull) Error() string {
 
 // Writer is a CSV logger
 type Writer struct {
-	Comma           rune // Comma is the field delimiter. It is set to ',' by NewWriter.
-	outPath         string
-	outFilePrefix   string
-	writer          *csv.Writer
-	currentFile     *os.File
-	currentFileName string    // current file name with path
-	lastFlush       time.Time // last flush time
-	logger          zerolog.Logger
-	lineCount       int
+	Comma            rune              // Comma is the field delimiter. It is set to ',' by NewWriter.
+	MaxFileSize      int64             // MaxFileSize is the maximum number of bytes per file, before compression. 0 means no limit.
+	MaxLines         int               // MaxLines is the maximum number of lines per file. 0 means no limit.
+	Retention        *Retention        // Retention, if set, deletes the oldest log files when the disk runs full instead of returning DiskFull.
+	Compress         bool              // Compress writes gzip compressed files (.csv.gz) if set.
+	Compressor       *Compressor       // Compressor, if set, compresses each file in the background after it has been closed.
+	Durability       Durability        // Durability controls flushing and syncing of the data.
+	Manifest         *ManifestInfo     // Manifest, if set, enables writing a JSON manifest for each file when it is closed.
+	RotationInterval time.Duration     // RotationInterval starts a new file on wall-clock boundaries aligned to local midnight, e.g. 1h or 24h. 0 means no time based rotation.
+	TemplateValues   map[string]string // TemplateValues holds the values of additional file name template placeholders, e.g. "vehicle".
+	LeftoverDir      string            // LeftoverDir is searched recursively for uncompressed files of previous runs to pass to the Compressor. Empty means the output directory.
+	outPath          string
+	outFileName      string            // file name prefix or template
+	template         *fileNameTemplate // created on first use
+	encoder          *csv.Writer       // encodes a single record into encoded
+	encoded          bytes.Buffer      // the most recent encoded record
+	writer           *bufio.Writer
+	compressor       *gzip.Writer // compressor between writer and currentFile, nil if not compressed
+	currentFile      *os.File
+	currentFileName  string    // current file name with path, while writing the file is named currentFileName + partialSuffix
+	lastFlush        time.Time // last flush time
+	logger           zerolog.Logger
+	lineCount        int
+	byteCount        int64     // number of bytes written to the current file
+	nextRotation     time.Time // time when the current file must be closed, zero if no time based rotation
+	now              func() time.Time
+	leftoversQueued  bool           // whether files of a previous run have been passed to the Compressor
+	manifest         *Manifest      // manifest of the current file, nil if no manifest is written
+	hasher           *hashingWriter // hashes the data written to currentFile, nil if no manifest is written
+	recordsSinceSync int            // number of records written since the last sync
+	stats            writerStats
 }
 
 // NewWriter creates a new CSV logger.
-func NewWriter(outPath string, outFilePrefix string) *Writer {
+// outFileName is either a prefix, e.g. "mvb", which results in file names like mvb0001.csv,
+// or a template such as "{vehicle}_{bus}_{date}_{index}.csv". Besides the placeholders {index}, {date}, {time} and {host},
+// a template may contain placeholders for the TemplateValues. If the template has no {index} placeholder, the index is appended.
+func NewWriter(outPath string, outFileName string) *Writer {
 	return &Writer{
 		Comma:           ',',
 		outPath:         outPath,
-		outFilePrefix:   outFilePrefix,
+		outFileName:     outFileName,
 		writer:          nil,
 		currentFile:     nil,
 		currentFileName: "",
 		lastFlush:       time.Time{},
 		logger:          log.With().Str("component", "csvlogger").Logger(),
+		now:             time.Now,
 	}
 }
 
 // Write writes a single CSV record to w.
 // If file size limit is reached, a FileSizeLimitReached error is returned. The current file is closed and a subsequent write will go into a new file.
-// If disk is full, a DiskFull error is returned.
+// If the rotation time of the current file is reached, a RotationTimeReached error is returned, with the same behavior.
+// In both cases, the record is not written.
+// If disk is full, a DiskFull error is returned. If a Retention is set, it is asked to free space first. If it succeeds,
+// the current file is closed and a FileSizeLimitReached error is returned instead, so the caller continues in a new file.
 func (w *Writer) Write(record []string) error {
+	start := time.Now()
+	err := w.write(record)
+	w.stats.add(&w.stats.Writes, start)
+	return err
+}
+
+func (w *Writer) write(record []string) error {
 	if w.writer == nil {
 		if err := w.newCsvWriter(); err != nil {
 			return err
 		}
 	}
 
-	err := w.writer.Write(record)
+	if !w.nextRotation.IsZero() && w.lineCount > 0 && !w.now().Before(w.nextRotation) {
+		w.Close()
+		w.logger.Info().Msgf("rotation time reached %s", w.currentFileName)
+		return fmt.Errorf("could not write record to file %s: %w", w.currentFileName, &RotationTimeReached{})
+	}
+
+	w.encoded.Reset()
+	w.encoder.Write(record)
+	w.encoder.Flush()
+	if err := w.encoder.Error(); err != nil {
+		return fmt.Errorf("could not encode record: %w", err)
+	}
+
+	// rotate before the record would exceed the configured limits
+	if w.limitReached(int64(w.encoded.Len())) {
+		w.Close()
+		w.logger.Info().Msgf("file size limit reached %s", w.currentFileName)
+		return fmt.Errorf("could not write record to file %s: %w", w.currentFileName, &FileSizeLimitReached{})
+	}
+
+	n, err := w.writer.Write(w.encoded.Bytes())
+	w.byteCount += int64(n)
 	if err != nil {
 		err = w.handleWriteErrors(err)
 		return fmt.Errorf("could not write record to file %s: %w", w.currentFileName, err)
@@ -85,18 +155,75 @@ func (w *Writer) Write(record []string) error {
 	}
 
 	// check if its time to flush
-	if time.Since(w.lastFlush) > 2*time.Second {
-		w.writer.Flush()
-		err := w.writer.Error()
+	w.recordsSinceSync++
+	syncNow := w.Durability.FsyncEveryRecords > 0 && w.recordsSinceSync >= w.Durability.FsyncEveryRecords
+	if syncNow || time.Since(w.lastFlush) > w.flushInterval() {
+		err := w.flush()
 		if err != nil {
 			err = w.handleWriteErrors(err)
 			return fmt.Errorf("could not flush file %s: %w", w.currentFileName, err)
 		}
 		w.lastFlush = time.Now()
+
+		if syncNow || w.Durability.Fsync {
+			if err := w.sync(); err != nil {
+				err = w.handleWriteErrors(err)
+				return fmt.Errorf("could not sync file %s: %w", w.currentFileName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Stats returns the latency statistics since the previous call to Stats. It may be called from any goroutine.
+func (w *Writer) Stats() WriterStats {
+	return w.stats.take()
+}
+
+func (w *Writer) flushInterval() time.Duration {
+	if w.Durability.FlushInterval > 0 {
+		return w.Durability.FlushInterval
+	}
+	return defaultFlushInterval
+}
+
+// flush writes all buffered data to the file.
+// When compressing, the compressor is flushed as well, so the file can be decompressed up to this point even if it is never closed.
+func (w *Writer) flush() error {
+	defer w.stats.add(&w.stats.Flushes, time.Now())
+
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if w.compressor != nil {
+		return w.compressor.Flush()
 	}
 	return nil
 }
 
+// sync commits the current file to disk
+func (w *Writer) sync() error {
+	defer w.stats.add(&w.stats.Syncs, time.Now())
+
+	w.recordsSinceSync = 0
+	return w.currentFile.Sync()
+}
+
+// limitReached checks whether writing n more bytes to the current file would exceed MaxFileSize or MaxLines.
+// The first line of a file is always written, regardless of the limits.
+func (w *Writer) limitReached(n int64) bool {
+	if w.lineCount == 0 {
+		return false
+	}
+	if w.MaxFileSize > 0 && w.byteCount+n > w.MaxFileSize {
+		return true
+	}
+	if w.MaxLines > 0 && w.lineCount >= w.MaxLines {
+		return true
+	}
+	return false
+}
+
 func (w *Writer) handleWriteErrors(err error) error {
 	var pathError *os.PathError
 
@@ -108,6 +235,19 @@ func (w *Writer) handleWriteErrors(err error) error {
 		}
 		if strings.Contains(pathError.Err.Error(), "no space left on device") {
 			w.logger.Warn().Msgf("disk full %s", w.currentFileName)
+			// the file may end with a part of the record, or of a record still buffered, so it must not be closed as usual
+			w.abandon()
+			freed := int64(0)
+			if w.Retention != nil {
+				freed, err = w.Retention.Enforce()
+				if err != nil {
+					w.logger.Error().Msgf("retention failed: %s", err)
+				}
+			}
+			w.recoverAbandoned()
+			if freed > 0 {
+				return &FileSizeLimitReached{}
+			}
 			return &DiskFull{}
 		}
 	}
@@ -118,38 +258,217 @@ func (w *Writer) newCsvWriter() error {
 	// close current file
 	w.Close()
 
+	if w.Compressor != nil && !w.leftoversQueued {
+		if err := w.queueLeftovers(); err != nil {
+			w.logger.Error().Msgf("could not queue uncompressed files: %s", err)
+		}
+		w.leftoversQueued = true
+	}
+
+	if w.Retention != nil {
+		if _, err := w.Retention.Enforce(); err != nil {
+			w.logger.Error().Msgf("retention failed: %s", err)
+		}
+	}
+
 	// create new file name
 	fileName, err := w.nextFileName()
 	if err != nil {
 		return fmt.Errorf("could not create new file name: %w", err)
 	}
-	f, err := os.Create(fileName)
+	f, err := os.Create(fileName + partialSuffix)
 	if err != nil {
 		return fmt.Errorf("could not create new file %s: %w", fileName, err)
 	}
 	w.currentFile = f
 	w.currentFileName = fileName
+	if w.Retention != nil {
+		w.Retention.activate(fileName + partialSuffix)
+		w.Retention.activate(w.outPath)
+	}
+	if w.Durability.FsyncDir {
+		if err := syncDir(w.outPath); err != nil {
+			w.logger.Error().Msgf("could not sync directory %s: %s", w.outPath, err)
+		}
+	}
 	w.logger.Info().Msgf("created new file %s", fileName)
-	w.writer = csv.NewWriter(f)
-	w.writer.Comma = w.Comma
+	var out io.Writer = f
+	w.manifest = nil
+	w.hasher = nil
+	if w.Manifest != nil {
+		w.hasher = newHashingWriter(f)
+		out = w.hasher
+		w.manifest = &Manifest{
+			File:       filepath.Base(fileName),
+			Created:    w.now(),
+			Version:    w.Manifest.Version,
+			Device:     w.Manifest.Device,
+			ConfigHash: w.Manifest.ConfigHash,
+		}
+		if err := writePartialManifest(fileName, w.manifest); err != nil {
+			w.logger.Error().Msgf("could not write manifest for %s: %s", fileName, err)
+		}
+	}
+	w.compressor = nil
+	if w.Compress {
+		w.compressor = gzip.NewWriter(out)
+		w.writer = bufio.NewWriter(w.compressor)
+	} else {
+		w.writer = bufio.NewWriter(out)
+	}
+	w.encoder = csv.NewWriter(&w.encoded)
+	w.encoder.Comma = w.Comma
 	w.lastFlush = time.Now()
 	w.lineCount = 0
+	w.byteCount = 0
+	w.recordsSinceSync = 0
+	w.nextRotation = time.Time{}
+	if w.RotationInterval > 0 {
+		w.nextRotation = nextRotationTime(w.now(), w.RotationInterval)
+	}
 	return nil
 }
 
-// Close closes the Writer.
+// nextRotationTime returns the next rotation boundary after now.
+// The boundaries are multiples of interval in local wall-clock time, starting at midnight. Each day starts with a new boundary
+// at midnight. On days with a clock change, the boundaries stay on the wall-clock times, e.g. a 24h interval always rotates at midnight.
+func nextRotationTime(now time.Time, interval time.Duration) time.Time {
+	year, month, day := now.Date()
+	nextMidnight := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+
+	wallClock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute +
+		time.Duration(now.Second())*time.Second + time.Duration(now.Nanosecond())
+	for n := wallClock/interval + 1; n*interval < 24*time.Hour; n++ {
+		boundary := n * interval
+		t := time.Date(year, month, day, int(boundary/time.Hour), int(boundary%time.Hour/time.Minute),
+			int(boundary%time.Minute/time.Second), int(boundary%time.Second), now.Location())
+		// a wall-clock time within the repeated hour of a backward clock change may be taken before now
+		if t.After(now) {
+			return t
+		}
+	}
+	return nextMidnight
+}
+
+// Close closes the Writer. The current file is finalised by removing its partial suffix.
 // subsequent writes to the Writer will go into a new file.
 func (w *Writer) Close() {
 	if w.writer != nil {
 		w.writer.Flush()
 		w.writer = nil
+		if w.compressor != nil {
+			w.compressor.Close()
+			w.compressor = nil
+		}
 		if w.currentFile != nil {
+			if w.Durability.Fsync || w.Durability.FsyncEveryRecords > 0 {
+				w.sync()
+			}
 			w.currentFile.Close()
 			w.currentFile = nil
+			if err := os.Rename(w.currentFileName+partialSuffix, w.currentFileName); err != nil {
+				w.logger.Error().Msgf("could not finalise %s: %s", w.currentFileName, err)
+			}
+			if w.Durability.FsyncDir {
+				if err := syncDir(w.outPath); err != nil {
+					w.logger.Error().Msgf("could not sync directory %s: %s", w.outPath, err)
+				}
+			}
+		}
+		if w.Retention != nil {
+			w.Retention.deactivate(w.currentFileName + partialSuffix)
+		}
+		if w.manifest != nil {
+			w.finishManifest()
+		}
+		if w.Compressor != nil && !w.Compress {
+			w.Compressor.Add(w.currentFileName)
 		}
 	}
 }
 
+// abandon closes the current file after a write error without flushing the buffered data. The file keeps its partial suffix
+// until recoverAbandoned has truncated it to its last complete record.
+func (w *Writer) abandon() {
+	if w.writer == nil {
+		return
+	}
+	w.writer = nil
+	w.compressor = nil
+	w.hasher = nil
+	if w.currentFile != nil {
+		w.currentFile.Close()
+		w.currentFile = nil
+	}
+}
+
+// recoverAbandoned finalises the abandoned file like Recover does after a power loss: The file is truncated to its last
+// complete record, or its complete records are compressed again, and the manifest is completed from the file content.
+// If this fails, e.g. since there is no space for a compressed file, the file is left for Recover on the next start.
+func (w *Writer) recoverAbandoned() {
+	partialName := w.currentFileName + partialSuffix
+	if w.Retention != nil {
+		defer w.Retention.deactivate(partialName)
+	}
+	var n int64
+	var err error
+	if w.Compress {
+		n, err = recoverGzip(partialName)
+	} else {
+		n, err = recoverPlain(partialName)
+	}
+	if err != nil {
+		w.logger.Error().Msgf("could not recover %s: %s", partialName, err)
+		return
+	}
+	w.logger.Warn().Msgf("recovered %s, kept %d bytes", partialName, n)
+	if w.manifest != nil {
+		if err := recoverManifest(w.currentFileName, n > 0, w.now()); err != nil {
+			w.logger.Error().Msgf("could not recover manifest of %s: %s", w.currentFileName, err)
+		}
+		w.manifest = nil
+	}
+	if w.Compressor != nil && !w.Compress && n > 0 {
+		w.Compressor.Add(w.currentFileName)
+	}
+}
+
+// WriteWithTimestamp writes the record and records its device timestamp ts for the manifest of the current file
+func (w *Writer) WriteWithTimestamp(record []string, ts int64) error {
+	if err := w.Write(record); err != nil {
+		return err
+	}
+	w.ObserveDeviceTimestamp(ts)
+	return nil
+}
+
+// ObserveDeviceTimestamp records the device timestamp of a written record for the manifest of the current file
+func (w *Writer) ObserveDeviceTimestamp(ts int64) {
+	if w.manifest == nil {
+		return
+	}
+	if w.manifest.FirstDeviceTimestamp == 0 || ts < w.manifest.FirstDeviceTimestamp {
+		w.manifest.FirstDeviceTimestamp = ts
+	}
+	if ts > w.manifest.LastDeviceTimestamp {
+		w.manifest.LastDeviceTimestamp = ts
+	}
+}
+
+// finishManifest completes the manifest of the closed file and writes it to disk
+func (w *Writer) finishManifest() {
+	w.manifest.Closed = w.now()
+	w.manifest.Lines = w.lineCount
+	w.manifest.Bytes = w.hasher.n
+	w.manifest.SHA256 = hex.EncodeToString(w.hasher.h.Sum(nil))
+	if err := writeManifest(w.currentFileName, w.manifest); err != nil {
+		w.logger.Error().Msgf("could not write manifest for %s: %s", w.currentFileName, err)
+	}
+	os.Remove(manifestName(w.currentFileName) + partialSuffix)
+	w.manifest = nil
+	w.hasher = nil
+}
+
 // scan the files in the output directory and find the next file name to use
 func (w *Writer) nextFileName() (string, error) {
 	// check what is the next file name to use
@@ -160,19 +479,43 @@ func (w *Writer) nextFileName() (string, error) {
 	highestIndex := 0
 
 	for _, file := range files {
-		if strings.HasPrefix(file.Name(), w.outFilePrefix) {
-			// get suffix
-			s := strings.TrimPrefix(file.Name(), w.outFilePrefix)
-			s = strings.TrimSuffix(s, ".csv")
-			// convert to int
-			i, err := strconv.Atoi(s)
-			if err == nil {
-				if i > highestIndex {
-					highestIndex = i
-				}
-			}
+		if i, ok := w.fileIndex(file.Name()); ok && i > highestIndex {
+			highestIndex = i
 		}
 	}
 	// create new file name
-	return fmt.Sprintf("%s/%s%04d.csv", w.outPath, w.outFilePrefix, highestIndex+1), nil
+	name := w.fileNameTemplate().expand(highestIndex+1, w.now())
+	if w.Compress {
+		name += ".gz"
+	}
+	return filepath.Join(w.outPath, name), nil
+}
+
+// fileIndex returns the index of name, if name is a file name (without path) of this Writer
+func (w *Writer) fileIndex(name string) (int, bool) {
+	return w.fileNameTemplate().index(name)
+}
+
+func (w *Writer) fileNameTemplate() *fileNameTemplate {
+	if w.template == nil {
+		w.template = newFileNameTemplate(w.outFileName, w.TemplateValues)
+	}
+	return w.template
+}
+
+// queueLeftovers passes all uncompressed files of this Writer to the Compressor, e.g. files left over from a previous run
+func (w *Writer) queueLeftovers() error {
+	dir := w.LeftoverDir
+	if dir == "" {
+		dir = w.outPath
+	}
+	return filepath.WalkDir(dir, func(name string, file os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, ok := w.fileIndex(file.Name()); ok && file.Type().IsRegular() && strings.HasSuffix(file.Name(), ".csv") {
+			w.Compressor.Add(name)
+		}
+		return nil
+	})
 }
@@ -1,8 +1,14 @@
 package csvlogger
 
 import (
+	"compress/gzip"
+	"io"
 	"os"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+	_ "time/tzdata" // Europe/Berlin for the clock change tests
 
 	"github.com/stretchr/testify/assert"
 )
@@ -38,4 +44,262 @@ func TestNewFileName(t *testing.T) {
 	name, err = w.nextFileName()
 	assert.NoError(t, err)
 	assert.Equal(t, testOutPath+"/test0008.csv", name)
+
+	// with compressed files
+	os.Create(testOutPath + "/test0009.csv.gz")
+	name, err = w.nextFileName()
+	assert.NoError(t, err)
+	assert.Equal(t, testOutPath+"/test0010.csv", name)
+
+	w.Compress = true
+	name, err = w.nextFileName()
+	assert.NoError(t, err)
+	assert.Equal(t, testOutPath+"/test0010.csv.gz", name)
+
+	// with partial files
+	os.Create(testOutPath + "/test0010.csv.partial")
+	name, err = w.nextFileName()
+	assert.NoError(t, err)
+	assert.Equal(t, testOutPath+"/test0011.csv.gz", name)
+}
+
+func TestMaxFileSize(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	w.MaxFileSize = 20
+
+	// each record is 10 bytes long
+	assert.NoError(t, w.Write([]string{"aaaa", "bbbb"}))
+	assert.NoError(t, w.Write([]string{"cccc", "dddd"}))
+
+	var fileSizeLimitReached *FileSizeLimitReached
+	err := w.Write([]string{"eeee", "ffff"})
+	assert.ErrorAs(t, err, &fileSizeLimitReached)
+
+	assert.NoError(t, w.Write([]string{"eeee", "ffff"}))
+	w.Close()
+
+	data, err := os.ReadFile(testOutPath + "/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "aaaa,bbbb\ncccc,dddd\n", string(data))
+
+	data, err = os.ReadFile(testOutPath + "/test0002.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "eeee,ffff\n", string(data))
+}
+
+func TestMaxLines(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	w.MaxLines = 3
+
+	var fileSizeLimitReached *FileSizeLimitReached
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, w.Write([]string{"a"}))
+	}
+	err := w.Write([]string{"b"})
+	assert.ErrorAs(t, err, &fileSizeLimitReached)
+	assert.NoError(t, w.Write([]string{"b"}))
+	w.Close()
+
+	data, err := os.ReadFile(testOutPath + "/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "a\na\na\n", string(data))
+
+	data, err = os.ReadFile(testOutPath + "/test0002.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "b\n", string(data))
+}
+
+func TestNextRotationTime(t *testing.T) {
+	loc := time.FixedZone("test", 3600)
+
+	now := time.Date(2022, 12, 27, 14, 32, 10, 0, loc)
+	assert.Equal(t, time.Date(2022, 12, 27, 15, 0, 0, 0, loc), nextRotationTime(now, time.Hour))
+	assert.Equal(t, time.Date(2022, 12, 27, 14, 45, 0, 0, loc), nextRotationTime(now, 15*time.Minute))
+	assert.Equal(t, time.Date(2022, 12, 28, 0, 0, 0, 0, loc), nextRotationTime(now, 24*time.Hour))
+	// intervals that do not divide a day evenly restart at midnight
+	assert.Equal(t, time.Date(2022, 12, 27, 21, 0, 0, 0, loc), nextRotationTime(now, 7*time.Hour))
+	now = time.Date(2022, 12, 27, 22, 0, 0, 0, loc)
+	assert.Equal(t, time.Date(2022, 12, 28, 0, 0, 0, 0, loc), nextRotationTime(now, 7*time.Hour))
+
+	// exactly on a boundary
+	now = time.Date(2022, 12, 27, 15, 0, 0, 0, loc)
+	assert.Equal(t, time.Date(2022, 12, 27, 16, 0, 0, 0, loc), nextRotationTime(now, time.Hour))
+}
+
+func TestNextRotationTimeClockChange(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	// clocks go forward from 02:00 CET to 03:00 CEST, the day has 23 hours
+	now := time.Date(2026, 3, 29, 0, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2026, 3, 30, 0, 0, 0, 0, loc), nextRotationTime(now, 24*time.Hour))
+	assert.Equal(t, time.Date(2026, 3, 29, 12, 0, 0, 0, loc), nextRotationTime(now, 12*time.Hour))
+	now = time.Date(2026, 3, 29, 1, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2026, 3, 29, 3, 0, 0, 0, loc), nextRotationTime(now, time.Hour))
+	now = time.Date(2026, 3, 29, 12, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2026, 3, 29, 13, 0, 0, 0, loc), nextRotationTime(now, time.Hour))
+
+	// clocks go back from 03:00 CEST to 02:00 CET, the day has 25 hours
+	now = time.Date(2026, 10, 25, 0, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2026, 10, 26, 0, 0, 0, 0, loc), nextRotationTime(now, 24*time.Hour))
+	assert.Equal(t, time.Date(2026, 10, 25, 12, 0, 0, 0, loc), nextRotationTime(now, 12*time.Hour))
+	now = time.Date(2026, 10, 25, 12, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2026, 10, 25, 13, 0, 0, 0, loc), nextRotationTime(now, time.Hour))
+	now = time.Date(2026, 10, 25, 23, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2026, 10, 26, 0, 0, 0, 0, loc), nextRotationTime(now, 24*time.Hour))
+	// within the repeated hour, the next boundary is always after now
+	now = time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC).Add(time.Hour).In(loc) // 02:30 CET, second pass
+	next := nextRotationTime(now, 15*time.Minute)
+	assert.True(t, next.After(now))
+	assert.Equal(t, 2, next.Hour())
+	assert.Equal(t, 45, next.Minute())
+}
+
+func TestRotationInterval(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	now := time.Date(2022, 12, 27, 14, 59, 0, 0, time.Local)
+	w := NewWriter(testOutPath, "test")
+	w.RotationInterval = time.Hour
+	w.now = func() time.Time { return now }
+
+	assert.NoError(t, w.Write([]string{"a"}))
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, w.Write([]string{"b"}))
+
+	var rotationTimeReached *RotationTimeReached
+	now = now.Add(30 * time.Second)
+	err := w.Write([]string{"c"})
+	assert.ErrorAs(t, err, &rotationTimeReached)
+	assert.NoError(t, w.Write([]string{"c"}))
+	w.Close()
+
+	data, err := os.ReadFile(testOutPath + "/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb\n", string(data))
+
+	data, err = os.ReadFile(testOutPath + "/test0002.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "c\n", string(data))
+}
+
+func readGzipFile(t *testing.T, name string) (string, error) {
+	f, err := os.Open(name)
+	assert.NoError(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(r)
+	return string(data), err
+}
+
+func TestCompress(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	w.Compress = true
+
+	assert.NoError(t, w.Write([]string{"a", "b"}))
+	// force a flush with the next write
+	w.lastFlush = time.Time{}
+	assert.NoError(t, w.Write([]string{"c", "d"}))
+
+	// the file is still open, but the flushed part must be readable
+	data, err := readGzipFile(t, testOutPath+"/test0001.csv.gz.partial")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "a,b\nc,d\n", data)
+
+	w.Close()
+	data, err = readGzipFile(t, testOutPath+"/test0001.csv.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "a,b\nc,d\n", data)
+}
+
+func TestDurability(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	w.Durability = Durability{
+		FlushInterval:     time.Hour,
+		FsyncDir:          true,
+		FsyncEveryRecords: 2,
+	}
+
+	assert.NoError(t, w.Write([]string{"a"}))
+	data, err := os.ReadFile(testOutPath + "/test0001.csv.partial")
+	assert.NoError(t, err)
+	assert.Equal(t, "", string(data))
+
+	assert.NoError(t, w.Write([]string{"b"}))
+	data, err = os.ReadFile(testOutPath + "/test0001.csv.partial")
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb\n", string(data))
+
+	stats := w.Stats()
+	assert.Equal(t, int64(2), stats.Writes.Count)
+	assert.Equal(t, int64(1), stats.Flushes.Count)
+	assert.Equal(t, int64(1), stats.Syncs.Count)
+	assert.GreaterOrEqual(t, stats.Writes.Max, stats.Writes.Mean())
+
+	// statistics are reset
+	stats = w.Stats()
+	assert.Equal(t, int64(0), stats.Writes.Count)
+	w.Close()
+}
+
+func TestDiskFull(t *testing.T) {
+	defer os.RemoveAll(testOutPath)
+	os.RemoveAll(testOutPath)
+	os.Mkdir(testOutPath, 0777)
+
+	w := NewWriter(testOutPath, "test")
+	w.Manifest = &ManifestInfo{Version: "1.2.3"}
+	w.Retention = NewRetention(testOutPath, 0, 20)
+	assert.NoError(t, w.Write([]string{"header"}))
+	assert.NoError(t, w.Write([]string{"a", "b"}))
+	w.writer.Flush()
+	// an older file the retention can delete
+	os.WriteFile(testOutPath+"/other0001.csv", []byte(strings.Repeat("x\n", 50)), 0644)
+	os.Chtimes(testOutPath+"/other0001.csv", time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	// the disk ran full while the next record was written
+	f, _ := os.OpenFile(testOutPath+"/test0001.csv.partial", os.O_APPEND|os.O_WRONLY, 0)
+	f.Write([]byte("c,"))
+	f.Close()
+
+	var fileSizeLimitReached *FileSizeLimitReached
+	err := w.handleWriteErrors(&os.PathError{Op: "write", Path: testOutPath + "/test0001.csv.partial", Err: syscall.ENOSPC})
+	assert.ErrorAs(t, err, &fileSizeLimitReached)
+	assert.NoFileExists(t, testOutPath+"/other0001.csv")
+
+	// the incomplete record is not part of the closed file
+	data, err := os.ReadFile(testOutPath + "/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "header\na,b\n", string(data))
+	assert.NoFileExists(t, testOutPath+"/test0001.csv.partial")
+	m, err := readManifest(testOutPath + "/test0001.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, m.Lines)
+	assert.Equal(t, fileSHA256(t, testOutPath+"/test0001.csv"), m.SHA256)
+	assert.Len(t, w.Retention.active, 1)
+
+	// the record is written again into a new file
+	assert.NoError(t, w.Write([]string{"c", "d"}))
+	w.Close()
+	data, err = os.ReadFile(testOutPath + "/test0002.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "c,d\n", string(data))
 }
@@ -0,0 +1,90 @@
+package mvbframe
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Device is a device of the Inventory
+type Device struct {
+	Address   uint16       `json:"address"`
+	FirstSeen time.Time    `json:"firstSeen"`
+	LastSeen  time.Time    `json:"lastSeen"`
+	Status    DeviceStatus `json:"status"` // last device status
+}
+
+// Inventory collects the devices that answer device status requests.
+// An Inventory is thread safe.
+type Inventory struct {
+	mu      sync.Mutex
+	devices map[uint16]*Device
+}
+
+// NewInventory creates an empty Inventory
+func NewInventory() *Inventory {
+	return &Inventory{
+		devices: make(map[uint16]*Device),
+	}
+}
+
+// Observe records the device status of the device with the address, received at seen.
+// It returns the device, whether the device is new or its status has changed, and whether the device is new.
+func (inv *Inventory) Observe(address uint16, status DeviceStatus, seen time.Time) (device Device, changed bool, isNew bool) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	d, ok := inv.devices[address]
+	if !ok {
+		d = &Device{
+			Address:   address,
+			FirstSeen: seen,
+			Status:    status,
+		}
+		inv.devices[address] = d
+	}
+	d.LastSeen = seen
+	changed = !ok || d.Status != status
+	d.Status = status
+	return *d, changed, !ok
+}
+
+// Devices returns a copy of the devices, sorted by address
+func (inv *Inventory) Devices() []Device {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	devices := make([]Device, 0, len(inv.devices))
+	for _, d := range inv.devices {
+		devices = append(devices, *d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Address < devices[j].Address })
+	return devices
+}
+
+// MarshalJSON writes the device status word in hex and the decoded bits
+func (s DeviceStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Word  string `json:"word"`
+		SP    bool   `json:"SP"`
+		BA    bool   `json:"BA"`
+		GW    bool   `json:"GW"`
+		MD    bool   `json:"MD"`
+		SER   bool   `json:"SER"`
+		DNR   bool   `json:"DNR"`
+		FRC   bool   `json:"FRC"`
+		Flags string `json:"flags"`
+	}{
+		Word:  fmt.Sprintf("%04x", uint16(s)),
+		SP:    s.Has(SP),
+		BA:    s.Has(BA),
+		GW:    s.Has(GW),
+		MD:    s.Has(MD),
+		SER:   s.Has(SER),
+		DNR:   s.Has(DNR),
+		FRC:   s.Has(FRC),
+		Flags: s.String(),
+	})
+}
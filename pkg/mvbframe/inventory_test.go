@@ -0,0 +1,52 @@
+package mvbframe_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ci4rail/velog/pkg/mvbframe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInventory(t *testing.T) {
+	inv := mvbframe.NewInventory()
+	t0 := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+
+	d, changed, isNew := inv.Observe(0x12, mvbframe.BA|mvbframe.DNR, t0)
+	assert.True(t, changed)
+	assert.True(t, isNew)
+	assert.Equal(t, t0, d.FirstSeen)
+
+	_, changed, isNew = inv.Observe(0x12, mvbframe.BA|mvbframe.DNR, t0.Add(time.Second))
+	assert.False(t, changed)
+	assert.False(t, isNew)
+
+	_, changed, isNew = inv.Observe(0x01, mvbframe.MD, t0.Add(2*time.Second))
+	assert.True(t, changed)
+	assert.True(t, isNew)
+
+	d, changed, isNew = inv.Observe(0x12, mvbframe.BA, t0.Add(3*time.Second))
+	assert.True(t, changed)
+	assert.False(t, isNew)
+	assert.Equal(t, t0, d.FirstSeen)
+	assert.Equal(t, t0.Add(3*time.Second), d.LastSeen)
+
+	// a new device is reported as new, even if it is seen at the same time as the previous one
+	_, changed, isNew = inv.Observe(0x02, mvbframe.MD, t0.Add(3*time.Second))
+	assert.True(t, changed)
+	assert.True(t, isNew)
+
+	devices := inv.Devices()
+	assert.Len(t, devices, 3)
+	assert.Equal(t, uint16(0x01), devices[0].Address)
+	assert.Equal(t, uint16(0x12), devices[2].Address)
+	assert.Equal(t, mvbframe.BA, devices[2].Status)
+}
+
+func TestDeviceStatusJSON(t *testing.T) {
+	data, err := json.Marshal(mvbframe.BA | mvbframe.DNR | 0x0300)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"word":"4302","SP":false,"BA":true,"GW":false,"MD":false,"SER":false,"DNR":true,"FRC":false,"flags":"BA|DNR"}`, string(data))
+}
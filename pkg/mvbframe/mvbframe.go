@@ -0,0 +1,126 @@
+// Package mvbframe decodes the supervisory and message data frames of the MVB, according to IEC 61375-3-1.
+package mvbframe
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// F-codes of the MVB master frames
+const (
+	FCodeMastershipTransfer = 8
+	FCodeGeneralEvent       = 9
+	FCodeMessageData        = 12
+	FCodeGroupEvent         = 13
+	FCodeSingleEvent        = 14
+	FCodeDeviceStatus       = 15
+)
+
+// frameTypes are the names of the frame types by F-code
+var frameTypes = [16]string{
+	"processData16",
+	"processData32",
+	"processData64",
+	"processData128",
+	"processData256",
+	"reserved",
+	"reserved",
+	"reserved",
+	"mastershipTransfer",
+	"generalEvent",
+	"reserved",
+	"reserved",
+	"messageData",
+	"groupEvent",
+	"singleEvent",
+	"deviceStatus",
+}
+
+// FrameType returns the name of the frame type of the F-code, e.g. "deviceStatus"
+func FrameType(fcode int) string {
+	if fcode < 0 || fcode >= len(frameTypes) {
+		return "invalid"
+	}
+	return frameTypes[fcode]
+}
+
+// Addresses returns the source and destination device address of a frame with the F-code, the address of the master frame
+// and the data of the slave frame. -1 is returned if an address is not part of the frame.
+func Addresses(fcode int, address uint32, data []byte) (source int, destination int) {
+	source = -1
+	destination = -1
+	switch fcode {
+	case FCodeMastershipTransfer, FCodeSingleEvent:
+		// the master frame addresses the device
+		destination = int(address & 0xfff)
+	case FCodeDeviceStatus:
+		// the addressed device responds with its status
+		source = int(address & 0xfff)
+	case FCodeMessageData:
+		// the link header of the message holds the device addresses
+		source = int(address & 0xfff)
+		if len(data) >= 4 {
+			destination = int(binary.BigEndian.Uint16(data[0:2]) & 0xfff)
+			source = int(binary.BigEndian.Uint16(data[2:4]) & 0xfff)
+		}
+	}
+	return source, destination
+}
+
+// DeviceStatus is the device status word, the slave frame of F-code 15
+type DeviceStatus uint16
+
+// Bits of the device status word. The first four bits are the capabilities of the device, followed by four class specific bits
+// and the common flags.
+const (
+	SP  DeviceStatus = 0x8000 // special device
+	BA  DeviceStatus = 0x4000 // bus administrator
+	GW  DeviceStatus = 0x2000 // gateway
+	MD  DeviceStatus = 0x1000 // message data capable
+	LAT DeviceStatus = 0x0080 // link layer attention
+	RLD DeviceStatus = 0x0040 // redundant line disturbed
+	SSD DeviceStatus = 0x0020 // some system disturbance
+	SDD DeviceStatus = 0x0010 // some device disturbance
+	SCD DeviceStatus = 0x0008 // some communication disturbance
+	FRC DeviceStatus = 0x0004 // forced
+	DNR DeviceStatus = 0x0002 // device not ready
+	SER DeviceStatus = 0x0001 // system reserved
+)
+
+// statusBits are the names of the status bits, in transmission order
+var statusBits = []struct {
+	bit  DeviceStatus
+	name string
+}{
+	{SP, "SP"}, {BA, "BA"}, {GW, "GW"}, {MD, "MD"},
+	{LAT, "LAT"}, {RLD, "RLD"}, {SSD, "SSD"}, {SDD, "SDD"}, {SCD, "SCD"}, {FRC, "FRC"}, {DNR, "DNR"}, {SER, "SER"},
+}
+
+// ParseDeviceStatus returns the device status of the slave frame data. It returns false if the data is too short.
+func ParseDeviceStatus(data []byte) (DeviceStatus, bool) {
+	if len(data) < 2 {
+		return 0, false
+	}
+	return DeviceStatus(binary.BigEndian.Uint16(data)), true
+}
+
+// Has checks whether all bits of b are set
+func (s DeviceStatus) Has(b DeviceStatus) bool {
+	return s&b == b
+}
+
+// ClassSpecific returns the four class specific bits, whose meaning depends on the capabilities
+func (s DeviceStatus) ClassSpecific() uint8 {
+	return uint8(s>>8) & 0x0f
+}
+
+// String returns the names of the set bits separated by '|', e.g. "BA|MD|DNR". The class specific bits are not included.
+func (s DeviceStatus) String() string {
+	var names []string
+	for _, b := range statusBits {
+		if s.Has(b.bit) {
+			names = append(names, b.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
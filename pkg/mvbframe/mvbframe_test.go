@@ -0,0 +1,50 @@
+package mvbframe_test
+
+import (
+	"testing"
+
+	"github.com/ci4rail/velog/pkg/mvbframe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameType(t *testing.T) {
+	assert.Equal(t, "processData16", mvbframe.FrameType(0))
+	assert.Equal(t, "mastershipTransfer", mvbframe.FrameType(8))
+	assert.Equal(t, "reserved", mvbframe.FrameType(10))
+	assert.Equal(t, "deviceStatus", mvbframe.FrameType(15))
+	assert.Equal(t, "invalid", mvbframe.FrameType(16))
+}
+
+func TestAddresses(t *testing.T) {
+	src, dst := mvbframe.Addresses(mvbframe.FCodeDeviceStatus, 0x123, []byte{0x10, 0x00})
+	assert.Equal(t, 0x123, src)
+	assert.Equal(t, -1, dst)
+
+	src, dst = mvbframe.Addresses(mvbframe.FCodeMastershipTransfer, 0x001, []byte{0x00, 0x02})
+	assert.Equal(t, -1, src)
+	assert.Equal(t, 0x001, dst)
+
+	// mode 0x1, destination 0x234, protocol 0x2, source 0x056
+	src, dst = mvbframe.Addresses(mvbframe.FCodeMessageData, 0x056, []byte{0x12, 0x34, 0x20, 0x56, 0x08})
+	assert.Equal(t, 0x056, src)
+	assert.Equal(t, 0x234, dst)
+
+	src, dst = mvbframe.Addresses(mvbframe.FCodeGeneralEvent, 0x000, nil)
+	assert.Equal(t, -1, src)
+	assert.Equal(t, -1, dst)
+}
+
+func TestDeviceStatus(t *testing.T) {
+	_, ok := mvbframe.ParseDeviceStatus([]byte{0x50})
+	assert.False(t, ok)
+
+	s, ok := mvbframe.ParseDeviceStatus([]byte{0x53, 0x02})
+	assert.True(t, ok)
+	assert.True(t, s.Has(mvbframe.BA))
+	assert.True(t, s.Has(mvbframe.MD))
+	assert.False(t, s.Has(mvbframe.GW))
+	assert.Equal(t, uint8(3), s.ClassSpecific())
+	assert.Equal(t, "BA|MD|DNR", s.String())
+	assert.Equal(t, "", mvbframe.DeviceStatus(0).String())
+}
@@ -0,0 +1,109 @@
+package mvbsignal
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Catalog holds the signals of the MVB ports
+type Catalog struct {
+	signals map[uint32][]Signal
+	len     int
+}
+
+// NewCatalog creates a catalog of the signals. It fails if a signal is invalid or a name is not unique.
+func NewCatalog(signals []Signal) (*Catalog, error) {
+	c := &Catalog{
+		signals: make(map[uint32][]Signal),
+	}
+	names := make(map[string]bool)
+	for _, s := range signals {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("duplicate signal name %s", s.Name)
+		}
+		names[s.Name] = true
+		c.signals[s.Address] = append(c.signals[s.Address], s)
+		c.len++
+	}
+	return c, nil
+}
+
+// Signals returns the signals of the port address, in catalog order
+func (c *Catalog) Signals(address uint32) []Signal {
+	return c.signals[address]
+}
+
+// Len returns the number of signals in the catalog
+func (c *Catalog) Len() int {
+	return c.len
+}
+
+// ReadCSV reads signals from a csv file. The first row names the columns, which are the Signal fields, e.g.
+// "Name,Address,ByteOffset,Type,Scale,Unit". The column names are case insensitive, missing columns take the zero value.
+// Addresses are decimal or hex with "0x" prefix.
+func ReadCSV(r io.Reader) ([]Signal, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %s", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "address", "type"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing csv column %s", required)
+		}
+	}
+
+	var signals []Signal
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return signals, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		s := Signal{
+			Name:      field("name"),
+			Type:      field("type"),
+			ByteOrder: field("byteorder"),
+			Unit:      field("unit"),
+		}
+		address, err := strconv.ParseUint(field("address"), 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, field("address"))
+		}
+		s.Address = uint32(address)
+		for name, p := range map[string]*int{"byteoffset": &s.ByteOffset, "bitoffset": &s.BitOffset, "length": &s.Length} {
+			if v := field(name); v != "" {
+				if *p, err = strconv.Atoi(v); err != nil {
+					return nil, fmt.Errorf("line %d: invalid %s %q", line, name, v)
+				}
+			}
+		}
+		for name, p := range map[string]*float64{"scale": &s.Scale, "offset": &s.Offset} {
+			if v := field(name); v != "" {
+				if *p, err = strconv.ParseFloat(v, 64); err != nil {
+					return nil, fmt.Errorf("line %d: invalid %s %q", line, name, v)
+				}
+			}
+		}
+		signals = append(signals, s)
+	}
+}
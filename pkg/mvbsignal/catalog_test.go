@@ -0,0 +1,48 @@
+package mvbsignal_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ci4rail/velog/pkg/mvbsignal"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalog(t *testing.T) {
+	c, err := mvbsignal.NewCatalog([]mvbsignal.Signal{
+		{Name: "speed", Address: 0x6af, Type: "UNSIGNED16"},
+		{Name: "doorsClosed", Address: 0x6af, Type: "BOOLEAN1", ByteOffset: 2},
+		{Name: "temperature", Address: 0x6b0, Type: "INTEGER8"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, c.Len())
+	signals := c.Signals(0x6af)
+	assert.Len(t, signals, 2)
+	assert.Equal(t, "speed", signals[0].Name)
+	assert.Equal(t, "doorsClosed", signals[1].Name)
+	assert.Len(t, c.Signals(0x100), 0)
+
+	_, err = mvbsignal.NewCatalog([]mvbsignal.Signal{
+		{Name: "speed", Address: 0x6af, Type: "UNSIGNED16"},
+		{Name: "speed", Address: 0x6b0, Type: "UNSIGNED16"},
+	})
+	assert.Error(t, err)
+}
+
+func TestReadCSV(t *testing.T) {
+	signals, err := mvbsignal.ReadCSV(strings.NewReader(`Name, Address, ByteOffset, BitOffset, Type, Scale, Offset, Unit
+speed, 0x6af, 0, , UNSIGNED16, 0.01, , km/h
+doorsClosed, 1712, 2, 3, BOOLEAN1, , ,
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []mvbsignal.Signal{
+		{Name: "speed", Address: 0x6af, Type: "UNSIGNED16", Scale: 0.01, Unit: "km/h"},
+		{Name: "doorsClosed", Address: 1712, ByteOffset: 2, BitOffset: 3, Type: "BOOLEAN1"},
+	}, signals)
+
+	_, err = mvbsignal.ReadCSV(strings.NewReader("Name,Type\nspeed,UNSIGNED16\n"))
+	assert.Error(t, err)
+	_, err = mvbsignal.ReadCSV(strings.NewReader("Name,Address,Type\nspeed,6af,UNSIGNED16\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,183 @@
+// Package mvbsignal decodes the signals of MVB process data ports into engineering values, according to a signal catalog.
+package mvbsignal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// byte orders of a Signal
+const (
+	BigEndian    = "bigEndian"
+	LittleEndian = "littleEndian"
+)
+
+type kind int
+
+const (
+	kindBoolean kind = iota
+	kindUnsigned
+	kindInteger
+	kindReal
+	kindBCD
+)
+
+// types maps the signal types to their kind and length in bits. Types with length 0 take the length of the Signal.
+var types = map[string]struct {
+	kind   kind
+	length int
+}{
+	"BOOLEAN1":   {kindBoolean, 1},
+	"UNSIGNED":   {kindUnsigned, 0},
+	"UNSIGNED8":  {kindUnsigned, 8},
+	"UNSIGNED16": {kindUnsigned, 16},
+	"UNSIGNED32": {kindUnsigned, 32},
+	"INTEGER":    {kindInteger, 0},
+	"INTEGER8":   {kindInteger, 8},
+	"INTEGER16":  {kindInteger, 16},
+	"INTEGER32":  {kindInteger, 32},
+	"REAL32":     {kindReal, 32},
+	"BCD":        {kindBCD, 0},
+	"BCD4":       {kindBCD, 4},
+	"BCD8":       {kindBCD, 8},
+	"BCD16":      {kindBCD, 16},
+	"BCD32":      {kindBCD, 32},
+}
+
+// Signal is a value within the data of an MVB port.
+// Values shorter than 8 bits are taken from a single byte, starting at BitOffset. Longer values must be byte aligned.
+type Signal struct {
+	Name       string  // unique name of the signal
+	Address    uint32  // MVB port address
+	ByteOffset int     // offset of the first byte of the signal within the port data
+	BitOffset  int     // offset of the signal within the byte, 0 is the least significant bit. Only for signals shorter than 8 bits.
+	Length     int     // length in bits, only required for the types UNSIGNED, INTEGER and BCD without size
+	Type       string  // BOOLEAN1, UNSIGNED, UNSIGNED8/16/32, INTEGER, INTEGER8/16/32, REAL32, BCD or BCD4/8/16/32
+	ByteOrder  string  // "bigEndian" or "littleEndian", default "bigEndian" like all MVB process data
+	Scale      float64 // the engineering value is raw value * Scale + Offset. 0 means 1.
+	Offset     float64 // added to the scaled raw value
+	Unit       string  // unit of the engineering value, e.g. "km/h"
+}
+
+// Validate checks whether the signal can be decoded
+func (s *Signal) Validate() error {
+	_, _, err := s.layout()
+	return err
+}
+
+// layout returns the kind and the length in bits of the signal
+func (s *Signal) layout() (kind, int, error) {
+	if s.Name == "" {
+		return 0, 0, fmt.Errorf("missing signal name")
+	}
+	if s.Address > 0xfff {
+		return 0, 0, fmt.Errorf("signal %s: invalid address %x", s.Name, s.Address)
+	}
+	t, ok := types[s.Type]
+	if !ok {
+		return 0, 0, fmt.Errorf("signal %s: invalid type %q", s.Name, s.Type)
+	}
+	length := t.length
+	if length == 0 {
+		length = s.Length
+	} else if s.Length != 0 && s.Length != length {
+		return 0, 0, fmt.Errorf("signal %s: length %d does not match type %s", s.Name, s.Length, s.Type)
+	}
+	if length < 1 || length > 32 {
+		return 0, 0, fmt.Errorf("signal %s: invalid length %d, must be 1..32", s.Name, length)
+	}
+	if t.kind == kindBCD && length%4 != 0 {
+		return 0, 0, fmt.Errorf("signal %s: invalid BCD length %d, must be a multiple of 4", s.Name, length)
+	}
+	if s.ByteOffset < 0 || s.BitOffset < 0 || s.BitOffset > 7 {
+		return 0, 0, fmt.Errorf("signal %s: invalid offset %d.%d", s.Name, s.ByteOffset, s.BitOffset)
+	}
+	if length < 8 {
+		if s.BitOffset+length > 8 {
+			return 0, 0, fmt.Errorf("signal %s: %d bits at bit offset %d exceed the byte", s.Name, length, s.BitOffset)
+		}
+	} else if s.BitOffset != 0 || length%8 != 0 {
+		return 0, 0, fmt.Errorf("signal %s: signals of 8 bits or more must be whole bytes", s.Name)
+	}
+	switch s.ByteOrder {
+	case "", BigEndian, LittleEndian:
+	default:
+		return 0, 0, fmt.Errorf("signal %s: invalid byte order %q, must be %s or %s", s.Name, s.ByteOrder, BigEndian, LittleEndian)
+	}
+	return t.kind, length, nil
+}
+
+// Decode returns the engineering value of the signal in the port data
+func (s *Signal) Decode(data []byte) (float64, error) {
+	k, length, err := s.layout()
+	if err != nil {
+		return 0, err
+	}
+	raw, err := s.raw(data, length)
+	if err != nil {
+		return 0, err
+	}
+
+	var v float64
+	switch k {
+	case kindInteger:
+		v = float64(int64(raw<<(64-length)) >> (64 - length))
+	case kindReal:
+		v = float64(math.Float32frombits(uint32(raw)))
+	case kindBCD:
+		for i := length/4 - 1; i >= 0; i-- {
+			digit := (raw >> (4 * i)) & 0xf
+			if digit > 9 {
+				return 0, fmt.Errorf("signal %s: invalid BCD digit %x", s.Name, digit)
+			}
+			v = v*10 + float64(digit)
+		}
+	default:
+		v = float64(raw)
+	}
+	return v*s.scale() + s.Offset, nil
+}
+
+// raw returns the unsigned raw value of the signal
+func (s *Signal) raw(data []byte, length int) (uint64, error) {
+	if length < 8 {
+		if s.ByteOffset >= len(data) {
+			return 0, fmt.Errorf("signal %s: data too short", s.Name)
+		}
+		return uint64(data[s.ByteOffset]>>s.BitOffset) & (1<<length - 1), nil
+	}
+	size := length / 8
+	if s.ByteOffset+size > len(data) {
+		return 0, fmt.Errorf("signal %s: data too short", s.Name)
+	}
+	var b [8]byte
+	if s.ByteOrder == LittleEndian {
+		copy(b[:], data[s.ByteOffset:s.ByteOffset+size])
+		return binary.LittleEndian.Uint64(b[:]), nil
+	}
+	copy(b[8-size:], data[s.ByteOffset:s.ByteOffset+size])
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+func (s *Signal) scale() float64 {
+	if s.Scale == 0 {
+		return 1
+	}
+	return s.Scale
+}
+
+// Format formats an engineering value of the signal without exponent. The value is rounded to the precision of
+// the signal type, so that e.g. a scale of 0.1 does not produce values like 0.30000000000000004.
+func (s *Signal) Format(v float64) string {
+	precision := 12
+	if s.Type == "REAL32" {
+		precision = 7
+	}
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(v, 'g', precision, 64), 64)
+	if err != nil {
+		rounded = v
+	}
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
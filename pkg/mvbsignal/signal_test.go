@@ -0,0 +1,55 @@
+package mvbsignal_test
+
+import (
+	"testing"
+
+	"github.com/ci4rail/velog/pkg/mvbsignal"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(t *testing.T, s mvbsignal.Signal, data []byte) string {
+	v, err := s.Decode(data)
+	assert.NoError(t, err)
+	return s.Format(v)
+}
+
+func TestDecode(t *testing.T) {
+	data := []byte{0x12, 0x34, 0xff, 0xfe, 0x3d, 0xcc, 0xcc, 0xcd, 0xa5}
+
+	assert.Equal(t, "4660", decode(t, mvbsignal.Signal{Name: "u16", Type: "UNSIGNED16"}, data))
+	assert.Equal(t, "13330", decode(t, mvbsignal.Signal{Name: "u16le", Type: "UNSIGNED16", ByteOrder: mvbsignal.LittleEndian}, data))
+	assert.Equal(t, "-2", decode(t, mvbsignal.Signal{Name: "i16", Type: "INTEGER16", ByteOffset: 2}, data))
+	assert.Equal(t, "-1", decode(t, mvbsignal.Signal{Name: "i8", Type: "INTEGER8", ByteOffset: 2}, data))
+	assert.Equal(t, "0.1", decode(t, mvbsignal.Signal{Name: "r32", Type: "REAL32", ByteOffset: 4}, data))
+	assert.Equal(t, "1234", decode(t, mvbsignal.Signal{Name: "bcd", Type: "BCD16"}, data))
+	assert.Equal(t, "3", decode(t, mvbsignal.Signal{Name: "bcd4", Type: "BCD4", BitOffset: 4, ByteOffset: 1}, data))
+
+	// 0xa5 = 1010 0101
+	assert.Equal(t, "1", decode(t, mvbsignal.Signal{Name: "b0", Type: "BOOLEAN1", ByteOffset: 8}, data))
+	assert.Equal(t, "0", decode(t, mvbsignal.Signal{Name: "b1", Type: "BOOLEAN1", ByteOffset: 8, BitOffset: 1}, data))
+	assert.Equal(t, "10", decode(t, mvbsignal.Signal{Name: "u4", Type: "UNSIGNED", Length: 4, ByteOffset: 8, BitOffset: 4}, data))
+	assert.Equal(t, "-6", decode(t, mvbsignal.Signal{Name: "i4", Type: "INTEGER", Length: 4, ByteOffset: 8, BitOffset: 4}, data))
+
+	// engineering value
+	assert.Equal(t, "466", decode(t, mvbsignal.Signal{Name: "speed", Type: "UNSIGNED16", Scale: 0.1}, data))
+	assert.Equal(t, "0.3", decode(t, mvbsignal.Signal{Name: "scaled", Type: "UNSIGNED8", ByteOffset: 8, Scale: 0.1, Offset: -16.2}, data))
+
+	_, err := (&mvbsignal.Signal{Name: "short", Type: "UNSIGNED32", ByteOffset: 6}).Decode(data)
+	assert.Error(t, err)
+	_, err = (&mvbsignal.Signal{Name: "bcd", Type: "BCD8", ByteOffset: 2}).Decode(data)
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, (&mvbsignal.Signal{Name: "ok", Address: 0x6af, Type: "UNSIGNED16", ByteOffset: 2}).Validate())
+	assert.Error(t, (&mvbsignal.Signal{Type: "UNSIGNED16"}).Validate())
+	assert.Error(t, (&mvbsignal.Signal{Name: "a", Address: 0x1000, Type: "UNSIGNED16"}).Validate())
+	assert.Error(t, (&mvbsignal.Signal{Name: "t", Type: "FLOAT"}).Validate())
+	assert.Error(t, (&mvbsignal.Signal{Name: "l", Type: "UNSIGNED16", Length: 8}).Validate())
+	assert.Error(t, (&mvbsignal.Signal{Name: "l", Type: "UNSIGNED"}).Validate())
+	assert.Error(t, (&mvbsignal.Signal{Name: "bcd", Type: "BCD", Length: 6}).Validate())
+	assert.Error(t, (&mvbsignal.Signal{Name: "bits", Type: "UNSIGNED", Length: 4, BitOffset: 6}).Validate())
+	assert.Error(t, (&mvbsignal.Signal{Name: "aligned", Type: "UNSIGNED16", BitOffset: 1}).Validate())
+	assert.Error(t, (&mvbsignal.Signal{Name: "order", Type: "UNSIGNED16", ByteOrder: "middle"}).Validate())
+}
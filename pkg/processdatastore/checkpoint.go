@@ -0,0 +1,123 @@
+package processdatastore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// checkpointVersion is the version of the checkpoint file format
+const checkpointVersion = 1
+
+// checkpoint is the content of a checkpoint file
+type checkpoint struct {
+	Version int               `json:"version"`
+	Created time.Time         `json:"created"`
+	Entries []checkpointEntry `json:"entries"`
+}
+
+// checkpointEntry is the most recent object of an address in a checkpoint file
+type checkpointEntry struct {
+	Address   uint32   `json:"address"`
+	Timestamp int64    `json:"timestamp"`
+	Data      string   `json:"data"` // hex
+	Info      []string `json:"info,omitempty"`
+}
+
+// restoredObject is an object restored from a checkpoint file
+type restoredObject struct {
+	timestamp int64
+	address   uint32
+	data      []byte
+	info      []string
+}
+
+func newCheckpointEntry(o Object) checkpointEntry {
+	return checkpointEntry{
+		Address:   o.Address(),
+		Timestamp: o.Timestamp(),
+		Data:      hex.EncodeToString(o.Data()),
+		Info:      o.AdditionalInfo(),
+	}
+}
+
+// writeCheckpoint writes the entries to the file name.
+// The file is written via a temporary file, so that a power loss never leaves a truncated checkpoint.
+func writeCheckpoint(name string, entries []checkpointEntry) error {
+	data, err := json.Marshal(checkpoint{
+		Version: checkpointVersion,
+		Created: time.Now(),
+		Entries: entries,
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(name + ".tmp")
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// readCheckpoint reads the objects from the checkpoint file name
+func readCheckpoint(name string) ([]*restoredObject, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var c checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d", c.Version)
+	}
+	objects := make([]*restoredObject, 0, len(c.Entries))
+	for _, e := range c.Entries {
+		d, err := hex.DecodeString(e.Data)
+		if err != nil {
+			return nil, fmt.Errorf("address %d: %w", e.Address, err)
+		}
+		objects = append(objects, &restoredObject{
+			timestamp: e.Timestamp,
+			address:   e.Address,
+			data:      d,
+			info:      e.Info,
+		})
+	}
+	return objects, nil
+}
+
+// Timestamp returns the reception timestamp of the object
+func (o *restoredObject) Timestamp() int64 {
+	return o.timestamp
+}
+
+// Address returns the address of the object
+func (o *restoredObject) Address() uint32 {
+	return o.address
+}
+
+// Data returns the data of the object
+func (o *restoredObject) Data() []byte {
+	return o.data
+}
+
+// AdditionalInfo returns additional info of the object
+func (o *restoredObject) AdditionalInfo() []string {
+	return o.info
+}
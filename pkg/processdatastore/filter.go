@@ -0,0 +1,98 @@
+package processdatastore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// ChangeFilter decides whether the data of an address counts as changed.
+// Bits that are cleared in Mask are ignored. Bytes beyond the length of Mask are compared completely.
+// The bytes covered by a Deadband are compared numerically instead.
+type ChangeFilter struct {
+	Mask      []byte
+	Deadbands []Deadband
+}
+
+// Deadband is a numeric value within the data, which counts as changed only if it differs from the
+// previously changed value by more than Deadband. Values are big endian, like all MVB process data.
+type Deadband struct {
+	Offset   int     // byte offset of the value
+	Size     int     // size of the value in bytes, 1, 2 or 4
+	Signed   bool    // whether the value is a two's complement signed integer
+	Deadband float64 // in raw units
+}
+
+// Validate checks whether the deadband can be applied
+func (d *Deadband) Validate() error {
+	if d.Offset < 0 {
+		return fmt.Errorf("invalid deadband offset %d", d.Offset)
+	}
+	switch d.Size {
+	case 1, 2, 4:
+	default:
+		return fmt.Errorf("invalid deadband size %d, must be 1, 2 or 4", d.Size)
+	}
+	if d.Deadband < 0 {
+		return fmt.Errorf("invalid deadband %g", d.Deadband)
+	}
+	return nil
+}
+
+// Changed checks whether data differs from reference, the data at the last change
+func (f *ChangeFilter) Changed(reference []byte, data []byte) bool {
+	if len(reference) != len(data) {
+		return true
+	}
+	for i := range data {
+		mask := byte(0xff)
+		if i < len(f.Mask) {
+			mask = f.Mask[i]
+		}
+		if (reference[i]^data[i])&mask != 0 && !f.inDeadband(i, len(data)) {
+			return true
+		}
+	}
+	for _, d := range f.Deadbands {
+		if d.Offset+d.Size > len(data) {
+			continue
+		}
+		if math.Abs(d.value(data)-d.value(reference)) > d.Deadband {
+			return true
+		}
+	}
+	return false
+}
+
+// inDeadband checks whether byte i of data with length n is compared numerically by a deadband
+func (f *ChangeFilter) inDeadband(i int, n int) bool {
+	for _, d := range f.Deadbands {
+		if d.Offset+d.Size <= n && i >= d.Offset && i < d.Offset+d.Size {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Deadband) value(data []byte) float64 {
+	b := data[d.Offset : d.Offset+d.Size]
+	switch d.Size {
+	case 1:
+		if d.Signed {
+			return float64(int8(b[0]))
+		}
+		return float64(b[0])
+	case 2:
+		v := binary.BigEndian.Uint16(b)
+		if d.Signed {
+			return float64(int16(v))
+		}
+		return float64(v)
+	default:
+		v := binary.BigEndian.Uint32(b)
+		if d.Signed {
+			return float64(int32(v))
+		}
+		return float64(v)
+	}
+}
@@ -0,0 +1,62 @@
+package processdatastore_test
+
+import (
+	"testing"
+
+	"github.com/ci4rail/velog/pkg/processdatastore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeFilterMask(t *testing.T) {
+	f := &processdatastore.ChangeFilter{Mask: []byte{0xff, 0xf0}}
+
+	assert.False(t, f.Changed([]byte{1, 0x20, 3}, []byte{1, 0x2f, 3}))
+	assert.True(t, f.Changed([]byte{1, 0x20, 3}, []byte{1, 0x30, 3}))
+	// bytes beyond the mask are compared completely
+	assert.True(t, f.Changed([]byte{1, 0x20, 3}, []byte{1, 0x20, 4}))
+	// different length
+	assert.True(t, f.Changed([]byte{1, 0x20}, []byte{1, 0x20, 3}))
+}
+
+func TestChangeFilterDeadband(t *testing.T) {
+	f := &processdatastore.ChangeFilter{
+		Deadbands: []processdatastore.Deadband{
+			{Offset: 1, Size: 2, Signed: true, Deadband: 5},
+		},
+	}
+
+	// 100 -> 105 is within the deadband
+	assert.False(t, f.Changed([]byte{9, 0x00, 100, 7}, []byte{9, 0x00, 105, 7}))
+	// 100 -> 94 is not
+	assert.True(t, f.Changed([]byte{9, 0x00, 100, 7}, []byte{9, 0x00, 94, 7}))
+	// -1 -> 2 is within the deadband
+	assert.False(t, f.Changed([]byte{9, 0xff, 0xff, 7}, []byte{9, 0x00, 0x02, 7}))
+	// bytes outside of the deadband are compared completely
+	assert.True(t, f.Changed([]byte{9, 0x00, 100, 7}, []byte{9, 0x00, 100, 8}))
+}
+
+func TestStoreChangeFilter(t *testing.T) {
+	s := processdatastore.NewStore()
+	s.SetChangeFilter(456, &processdatastore.ChangeFilter{
+		Deadbands: []processdatastore.Deadband{{Offset: 0, Size: 1, Deadband: 2}},
+	})
+
+	s.Write(newMyObject(123, 456, []byte{10}))
+	_, _, changed, _ := s.ReadWithChange(456)
+	assert.True(t, changed)
+
+	// slow drift is reported once it exceeds the deadband compared to the last change
+	s.Write(newMyObject(124, 456, []byte{11}))
+	_, _, changed, _ = s.ReadWithChange(456)
+	assert.False(t, changed)
+	s.Write(newMyObject(125, 456, []byte{12}))
+	_, _, changed, _ = s.ReadWithChange(456)
+	assert.False(t, changed)
+	s.Write(newMyObject(126, 456, []byte{13}))
+	_, _, changed, _ = s.ReadWithChange(456)
+	assert.True(t, changed)
+	s.Write(newMyObject(127, 456, []byte{14}))
+	_, _, changed, _ = s.ReadWithChange(456)
+	assert.False(t, changed)
+}
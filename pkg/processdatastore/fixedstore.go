@@ -0,0 +1,442 @@
+package processdatastore
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// FixedStoreSize is the number of addresses of a FixedStore, i.e. the 12 bit MVB address space
+	FixedStoreSize = 4096
+	// MaxFixedDataSize is the maximum data size of an object in a FixedStore, i.e. the largest MVB port size
+	MaxFixedDataSize = 32
+)
+
+// InfoCoder is implemented by objects whose additional info is a single number, e.g. the F-code of an MVB telegram.
+// FixedStore uses it to keep the additional info without allocation.
+type InfoCoder interface {
+	InfoCode() int
+}
+
+// fixedRecord is a copy of an object in a FixedStore
+type fixedRecord struct {
+	timestamp   int64
+	hasInfoCode bool
+	infoCode    int
+	info        []string // additional info of objects that do not implement InfoCoder
+	size        int
+	data        [MaxFixedDataSize]byte
+}
+
+// fixedEntry is the process data store for a single address of a FixedStore
+type fixedEntry struct {
+	valid      bool // whether the address got any update
+	recent     fixedRecord
+	numUpdates int
+	changed    bool
+	refSize    int
+	reference  [MaxFixedDataSize]byte // data at the last change
+	history    *ring[fixedRecord]
+	restored   bool // whether recent has been restored from a checkpoint
+	staleness
+	timing
+}
+
+// FixedStore is a process data store for the 4096 MVB addresses.
+// In contrast to Store, it copies the data of written objects into preallocated buffers, so writing does not allocate
+// and the caller may reuse the object after Write() returns. Objects returned by Read() and Snapshot() are copies as well.
+// Objects with an address beyond FixedStoreSize or data larger than MaxFixedDataSize are ignored.
+// The FixedStore is thread safe.
+type FixedStore struct {
+	sync.Mutex
+	entry      [FixedStoreSize]fixedEntry
+	filters    [FixedStoreSize]*ChangeFilter
+	depth      int                           // default history depth
+	depths     [FixedStoreSize]int           // history depth per address
+	depthSet   [FixedStoreSize]bool          // whether depths is set for the address
+	timeout    time.Duration                 // default stale timeout
+	timeouts   [FixedStoreSize]time.Duration // stale timeout per address
+	timeoutSet [FixedStoreSize]bool          // whether timeouts is set for the address
+}
+
+// fixedObject is a copy of an object in a FixedStore, returned to the caller
+type fixedObject struct {
+	timestamp   int64
+	address     uint32
+	data        []byte
+	hasInfoCode bool
+	infoCode    int
+	info        []string
+}
+
+// NewFixedStore creates a new fixed process data store
+func NewFixedStore() *FixedStore {
+	return &FixedStore{}
+}
+
+// SetChangeFilter sets the filter which decides whether the data of address counts as changed.
+// Without filter, any difference of the data is a change.
+func (s *FixedStore) SetChangeFilter(address uint32, f *ChangeFilter) {
+	if address >= FixedStoreSize {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.filters[address] = f
+}
+
+// SetHistoryDepth sets the number of recent objects to keep for address, overriding the default history depth.
+// 0 disables the history of the address. The history buffer is allocated with the next update of the address.
+func (s *FixedStore) SetHistoryDepth(address uint32, depth int) {
+	if address >= FixedStoreSize {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.depths[address] = depth
+	s.depthSet[address] = true
+}
+
+// SetDefaultHistoryDepth sets the number of recent objects to keep for all addresses without their own history depth.
+// 0, the default, disables the history.
+func (s *FixedStore) SetDefaultHistoryDepth(depth int) {
+	s.Lock()
+	defer s.Unlock()
+	s.depth = depth
+}
+
+// SetStaleTimeout sets the time after which address is reported as stale by Snapshot() if it did not receive an update,
+// overriding the default stale timeout. 0 disables the staleness detection of the address.
+func (s *FixedStore) SetStaleTimeout(address uint32, timeout time.Duration) {
+	if address >= FixedStoreSize {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.timeouts[address] = timeout
+	s.timeoutSet[address] = true
+}
+
+// SetDefaultStaleTimeout sets the stale timeout of all addresses without their own stale timeout.
+// 0, the default, disables the staleness detection.
+func (s *FixedStore) SetDefaultStaleTimeout(timeout time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.timeout = timeout
+}
+
+// Write copies an object into the process data store, so the caller may reuse the object and its data after Write() returns
+func (s *FixedStore) Write(o Object) {
+	address := o.Address()
+	data := o.Data()
+	if address >= FixedStoreSize || len(data) > MaxFixedDataSize {
+		return
+	}
+	infoCoder, hasInfoCode := o.(InfoCoder)
+	var info []string
+	if !hasInfoCode {
+		info = o.AdditionalInfo()
+	}
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	e := &s.entry[address]
+	// the first update after a restore confirms the restored data, so it counts as change as well
+	if !e.valid || e.restored || s.dataChanged(address, e.reference[:e.refSize], data) {
+		e.changed = true
+		e.refSize = copy(e.reference[:], data)
+	}
+	e.valid = true
+	e.recent = fixedRecord{
+		timestamp:   o.Timestamp(),
+		hasInfoCode: hasInfoCode,
+		info:        info,
+	}
+	if hasInfoCode {
+		e.recent.infoCode = infoCoder.InfoCode()
+	}
+	e.recent.size = copy(e.recent.data[:], data)
+	e.numUpdates++
+	e.restored = false
+	e.update(now)
+	e.add(e.recent.timestamp)
+
+	depth := s.depth
+	if s.depthSet[address] {
+		depth = s.depths[address]
+	}
+	if depth == 0 {
+		e.history = nil
+	} else {
+		if e.history == nil || len(e.history.buf) != depth {
+			e.history = newRing[fixedRecord](depth)
+		}
+		*e.history.next() = e.recent
+	}
+}
+
+// Read reads the entry for the specified address from the process data store.
+// In addition, it returns the number of updates for the address since the last call to Read().
+// If the address has never got an update, an error is returned.
+func (s *FixedStore) Read(address uint32) (Object, int, error) {
+	o, numUpdates, _, err := s.ReadWithChange(address)
+	return o, numUpdates, err
+}
+
+// ReadWithChange reads the entry for the specified address like Read().
+// In addition, it returns whether the data of the address changed since the last call to Read() or ReadWithChange(), see Store.ReadWithChange().
+func (s *FixedStore) ReadWithChange(address uint32) (Object, int, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if address >= FixedStoreSize || !s.entry[address].valid {
+		return nil, 0, false, fmt.Errorf("no entries for address %d", address)
+	}
+	e := &s.entry[address]
+	o := &fixedObject{}
+	e.recent.copyTo(o, address, make([]byte, e.recent.size))
+	numUpdates := e.numUpdates
+	changed := e.changed
+	e.reset()
+	return o, numUpdates, changed, nil
+}
+
+// Snapshot returns all entries, sorted by address in ascending order, and resets their update counts and change flags,
+// as if Read() had been called for each address. All entries are taken at the same time.
+func (s *FixedStore) Snapshot() []SnapshotEntry {
+	s.Lock()
+	defer s.Unlock()
+
+	// allocate all objects and their data at once
+	n := 0
+	size := 0
+	for i := range s.entry {
+		e := &s.entry[i]
+		if !e.valid {
+			continue
+		}
+		n++
+		size += e.recent.size
+		if e.history != nil {
+			for j := 0; j < e.history.len(); j++ {
+				n++
+				size += e.history.at(j).size
+			}
+		}
+	}
+	snapshot := make([]SnapshotEntry, 0, n)
+	objects := make([]fixedObject, n)
+	buf := make([]byte, size)
+
+	object := func(r *fixedRecord, address uint32) *fixedObject {
+		o := &objects[0]
+		objects = objects[1:]
+		r.copyTo(o, address, buf[:r.size:r.size])
+		buf = buf[r.size:]
+		return o
+	}
+
+	now := time.Now()
+	for i := range s.entry {
+		e := &s.entry[i]
+		if !e.valid {
+			continue
+		}
+		timeout := s.timeout
+		if s.timeoutSet[i] {
+			timeout = s.timeouts[i]
+		}
+		// fill the entry in place, copying a complete SnapshotEntry is expensive for large stores
+		snapshot = append(snapshot, SnapshotEntry{})
+		se := &snapshot[len(snapshot)-1]
+		se.Object = object(&e.recent, uint32(i))
+		se.Updates = e.numUpdates
+		se.Changed = e.changed
+		se.LastUpdate = e.lastUpdate
+		if e.checked(timeout) {
+			se.Stale, se.Recovered = e.check(now, timeout)
+		}
+		if e.n > 0 {
+			se.Timing = e.take()
+		}
+		se.Restored = e.restored
+		if e.history != nil && e.history.len() > 0 {
+			se.History = make([]Object, e.history.len())
+			for j := range se.History {
+				se.History[j] = object(e.history.at(j), uint32(i))
+			}
+		}
+		e.reset()
+	}
+	return snapshot
+}
+
+// Peek returns all entries, sorted by address in ascending order, like Snapshot(), but does not start a new read period:
+// The update counts, change flags, timing statistics and staleness are left untouched for the next Snapshot().
+// Therefore, the entries have no History, Timing, Stale and Recovered.
+func (s *FixedStore) Peek() []SnapshotEntry {
+	s.Lock()
+	defer s.Unlock()
+
+	// allocate all objects and their data at once
+	n := 0
+	size := 0
+	for i := range s.entry {
+		if s.entry[i].valid {
+			n++
+			size += s.entry[i].recent.size
+		}
+	}
+	entries := make([]SnapshotEntry, n)
+	objects := make([]fixedObject, n)
+	buf := make([]byte, size)
+
+	n = 0
+	for i := range s.entry {
+		e := &s.entry[i]
+		if !e.valid {
+			continue
+		}
+		e.recent.copyTo(&objects[n], uint32(i), buf[:e.recent.size:e.recent.size])
+		buf = buf[e.recent.size:]
+		se := &entries[n]
+		se.Object = &objects[n]
+		se.Updates = e.numUpdates
+		se.Changed = e.changed
+		se.LastUpdate = e.lastUpdate
+		se.Restored = e.restored
+		n++
+	}
+	return entries
+}
+
+// Checkpoint saves the most recent object of each address to the file name, so that it can be restored with Restore()
+func (s *FixedStore) Checkpoint(name string) error {
+	s.Lock()
+	var entries []checkpointEntry
+	var o fixedObject
+	for i := range s.entry {
+		e := &s.entry[i]
+		if e.valid {
+			e.recent.copyTo(&o, uint32(i), make([]byte, e.recent.size))
+			entries = append(entries, newCheckpointEntry(&o))
+		}
+	}
+	s.Unlock()
+
+	return writeCheckpoint(name, entries)
+}
+
+// Restore loads the objects from the checkpoint file name into the store and returns the number of restored objects.
+// Only addresses that have not received any update yet are restored. They are reported as Restored by Snapshot() until their next update.
+// Restored objects do not count as update or change.
+func (s *FixedStore) Restore(name string) (int, error) {
+	objects, err := readCheckpoint(name)
+	if err != nil {
+		return 0, err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, o := range objects {
+		if o.address >= FixedStoreSize || len(o.data) > MaxFixedDataSize || s.entry[o.address].valid {
+			continue
+		}
+		e := &s.entry[o.address]
+		e.valid = true
+		e.restored = true
+		e.recent = fixedRecord{
+			timestamp: o.timestamp,
+			info:      o.info,
+		}
+		// an object written with an info code has been saved with the code as its only info, restore it as info code again
+		if len(o.info) == 1 {
+			if code, err := strconv.Atoi(o.info[0]); err == nil {
+				e.recent.hasInfoCode = true
+				e.recent.infoCode = code
+				e.recent.info = nil
+			}
+		}
+		e.recent.size = copy(e.recent.data[:], o.data)
+		e.refSize = copy(e.reference[:], o.data)
+		e.lastUpdate = now
+		n++
+	}
+	return n, nil
+}
+
+// List returns a list of all addresses in the process data store which have received any updates since the store creation.
+// The list is sorted in ascending order.
+func (s *FixedStore) List() []int {
+	s.Lock()
+	defer s.Unlock()
+
+	keys := make([]int, 0)
+	for i := range s.entry {
+		if s.entry[i].valid {
+			keys = append(keys, i)
+		}
+	}
+	return keys
+}
+
+// dataChanged checks whether data of address differs from reference, the data at the last change
+func (s *FixedStore) dataChanged(address uint32, reference []byte, data []byte) bool {
+	if f := s.filters[address]; f != nil {
+		return f.Changed(reference, data)
+	}
+	return !bytes.Equal(reference, data)
+}
+
+// reset starts a new read period
+func (e *fixedEntry) reset() {
+	e.numUpdates = 0
+	e.changed = false
+	e.clear()
+	if e.history != nil {
+		e.history.reset()
+	}
+}
+
+// copyTo copies the record into o, using buf for the data
+func (r *fixedRecord) copyTo(o *fixedObject, address uint32, buf []byte) {
+	copy(buf, r.data[:r.size])
+	*o = fixedObject{
+		timestamp:   r.timestamp,
+		address:     address,
+		data:        buf,
+		hasInfoCode: r.hasInfoCode,
+		infoCode:    r.infoCode,
+		info:        r.info,
+	}
+}
+
+// Timestamp returns the reception timestamp of the object
+func (o *fixedObject) Timestamp() int64 {
+	return o.timestamp
+}
+
+// Address returns the address of the object
+func (o *fixedObject) Address() uint32 {
+	return o.address
+}
+
+// Data returns the data of the object
+func (o *fixedObject) Data() []byte {
+	return o.data
+}
+
+// AdditionalInfo returns additional info of the object
+func (o *fixedObject) AdditionalInfo() []string {
+	if o.hasInfoCode {
+		return []string{strconv.Itoa(o.infoCode)}
+	}
+	return o.info
+}
@@ -0,0 +1,179 @@
+package processdatastore_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ci4rail/velog/pkg/processdatastore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// codedObject is an object with an info code, like an MVB telegram with its F-code
+type codedObject struct {
+	MyObject
+	code int
+}
+
+func (o *codedObject) InfoCode() int {
+	return o.code
+}
+
+func (o *codedObject) AdditionalInfo() []string {
+	panic("must not be called by FixedStore.Write")
+}
+
+func TestFixedStore(t *testing.T) {
+	var _ processdatastore.ObjectStore = processdatastore.NewFixedStore()
+	var _ processdatastore.ObjectStore = processdatastore.NewStore()
+
+	s := processdatastore.NewFixedStore()
+	data := []byte{1, 2, 3}
+	s.Write(newMyObject(123, 456, data))
+
+	// the data is copied
+	data[0] = 9
+	o1, updates, err := s.Read(456)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updates)
+	assert.Equal(t, int64(123), o1.Timestamp())
+	assert.Equal(t, uint32(456), o1.Address())
+	assert.Equal(t, []byte{1, 2, 3}, o1.Data())
+
+	// now try to read the entry again, numUpdates should be 0
+	_, updates, err = s.Read(456)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updates)
+
+	// multiple writes
+	s.Write(newMyObject(124, 456, []byte{2, 3, 4}))
+	s.Write(newMyObject(125, 456, []byte{2, 3}))
+	o1, updates, changed, err := s.ReadWithChange(456)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updates)
+	assert.True(t, changed)
+	assert.Equal(t, []byte{2, 3}, o1.Data())
+
+	// never written and invalid addresses
+	o1, updates, err = s.Read(111)
+	assert.Error(t, err)
+	assert.Nil(t, o1)
+	assert.Equal(t, 0, updates)
+	s.Write(newMyObject(126, processdatastore.FixedStoreSize, []byte{1}))
+	_, _, err = s.Read(processdatastore.FixedStoreSize)
+	assert.Error(t, err)
+
+	// list and snapshot
+	s.Write(newMyObject(127, 458, []byte{2, 3, 7}))
+	s.Write(&codedObject{MyObject: *newMyObject(128, 457, []byte{2, 3, 8}), code: 4})
+	assert.Equal(t, []int{456, 457, 458}, s.List())
+
+	snapshot := s.Snapshot()
+	assert.Equal(t, 3, len(snapshot))
+	assert.Equal(t, uint32(456), snapshot[0].Object.Address())
+	assert.Equal(t, 0, snapshot[0].Updates)
+	assert.Equal(t, []byte{2, 3, 8}, snapshot[1].Object.Data())
+	assert.Equal(t, []string{"4"}, snapshot[1].Object.AdditionalInfo())
+	assert.Equal(t, 1, snapshot[2].Updates)
+	assert.True(t, snapshot[2].Changed)
+
+	snapshot = s.Snapshot()
+	assert.Equal(t, 0, snapshot[2].Updates)
+	assert.False(t, snapshot[2].Changed)
+}
+
+func TestFixedStoreHistory(t *testing.T) {
+	testHistory(t, processdatastore.NewFixedStore())
+}
+
+func TestFixedStoreTiming(t *testing.T) {
+	testTiming(t, processdatastore.NewFixedStore())
+}
+
+func TestFixedStoreCheckpoint(t *testing.T) {
+	testCheckpoint(t, func() processdatastore.ObjectStore { return processdatastore.NewFixedStore() })
+}
+
+func TestFixedStoreCheckpointInfo(t *testing.T) {
+	s := processdatastore.NewFixedStore()
+	s.Write(&codedObject{MyObject: *newMyObject(100, 456, []byte{1}), code: 4})
+	s.Write(newMyObject(101, 457, []byte{2}))
+	name := filepath.Join(t.TempDir(), "checkpoint.json")
+	assert.NoError(t, s.Checkpoint(name))
+
+	s = processdatastore.NewFixedStore()
+	n, err := s.Restore(name)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	snapshot := s.Snapshot()
+	// the info code is restored
+	assert.Equal(t, []string{"4"}, snapshot[0].Object.AdditionalInfo())
+	// objects without info are restored without info
+	assert.Empty(t, snapshot[1].Object.AdditionalInfo())
+}
+
+func TestFixedStoreReuse(t *testing.T) {
+	s := processdatastore.NewFixedStore()
+	s.SetDefaultHistoryDepth(2)
+
+	// the caller reuses the object and its data for each write
+	o := newMyObject(100, 456, []byte{1})
+	s.Write(o)
+	o.timestamp = 101
+	o.data[0] = 2
+	s.Write(o)
+	o.timestamp = 102
+	o.data[0] = 3
+
+	snapshot := s.Snapshot()
+	assert.Equal(t, int64(101), snapshot[0].Object.Timestamp())
+	assert.Equal(t, []byte{2}, snapshot[0].Object.Data())
+	assert.Equal(t, int64(100), snapshot[0].History[0].Timestamp())
+	assert.Equal(t, []byte{1}, snapshot[0].History[0].Data())
+}
+
+func TestFixedStorePeek(t *testing.T) {
+	testPeek(t, processdatastore.NewFixedStore())
+}
+
+func TestFixedStoreStale(t *testing.T) {
+	testStale(t, processdatastore.NewFixedStore())
+}
+
+func benchmarkWrite(b *testing.B, s processdatastore.ObjectStore, newObject func(o *codedObject) processdatastore.Object) {
+	o := &codedObject{MyObject: MyObject{data: make([]byte, 8)}, code: 1}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o.timestamp = int64(i)
+		o.address = uint32(i % processdatastore.FixedStoreSize)
+		s.Write(newObject(o))
+	}
+}
+
+func BenchmarkStoreWrite(b *testing.B) {
+	// Store keeps the object, so each write needs a new one
+	benchmarkWrite(b, processdatastore.NewStore(), func(o *codedObject) processdatastore.Object {
+		c := *o
+		return &c
+	})
+}
+
+func BenchmarkFixedStoreWrite(b *testing.B) {
+	// FixedStore copies the object, so it can be reused
+	benchmarkWrite(b, processdatastore.NewFixedStore(), func(o *codedObject) processdatastore.Object {
+		return o
+	})
+}
+
+func BenchmarkFixedStoreSnapshot(b *testing.B) {
+	s := processdatastore.NewFixedStore()
+	for a := 0; a < processdatastore.FixedStoreSize; a++ {
+		s.Write(newMyObject(int64(a), uint32(a), []byte{1, 2, 3, 4}))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Snapshot()
+	}
+}
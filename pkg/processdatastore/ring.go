@@ -0,0 +1,40 @@
+package processdatastore
+
+// ring is a ring buffer that keeps the most recent elements
+type ring[T any] struct {
+	buf  []T
+	head int // index of the oldest element
+	n    int // number of elements
+}
+
+func newRing[T any](depth int) *ring[T] {
+	return &ring[T]{
+		buf: make([]T, depth),
+	}
+}
+
+// next returns the slot for a new element. If the ring is full, the oldest element is overwritten.
+func (r *ring[T]) next() *T {
+	i := (r.head + r.n) % len(r.buf)
+	if r.n < len(r.buf) {
+		r.n++
+	} else {
+		r.head = (r.head + 1) % len(r.buf)
+	}
+	return &r.buf[i]
+}
+
+// at returns the i-th oldest element
+func (r *ring[T]) at(i int) *T {
+	return &r.buf[(r.head+i)%len(r.buf)]
+}
+
+func (r *ring[T]) len() int {
+	return r.n
+}
+
+// reset removes all elements, but keeps the buffer
+func (r *ring[T]) reset() {
+	r.head = 0
+	r.n = 0
+}
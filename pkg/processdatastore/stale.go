@@ -0,0 +1,36 @@
+package processdatastore
+
+import "time"
+
+// staleness tracks whether an address stopped receiving updates
+type staleness struct {
+	lastUpdate time.Time
+	stale      bool // no update within the timeout, reported by the last Snapshot()
+	recovered  bool // got an update after it had been stale, not yet reported
+}
+
+// update records an update at now
+func (s *staleness) update(now time.Time) {
+	s.lastUpdate = now
+	if s.stale {
+		s.stale = false
+		s.recovered = true
+	}
+}
+
+// checked returns whether check must be called for the timeout, i.e. whether it can report anything
+func (s *staleness) checked(timeout time.Duration) bool {
+	return timeout > 0 || s.recovered
+}
+
+// check returns whether the address became stale or recovered since the previous check.
+// A timeout of 0 disables the staleness detection.
+func (s *staleness) check(now time.Time, timeout time.Duration) (becameStale bool, recovered bool) {
+	recovered = s.recovered
+	s.recovered = false
+	if timeout > 0 && !s.stale && now.Sub(s.lastUpdate) > timeout {
+		s.stale = true
+		becameStale = true
+	}
+	return becameStale, recovered
+}
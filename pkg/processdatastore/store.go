@@ -1,35 +1,147 @@
 // Package processdatastore is a package that provides a process data store.
-// The process data store is used to store process data objects associated with an address. For each address, only the most recent object is stored.
-// The number of updates for each address is also stored.
-// The typical use case is to call Write() from one goroutine and List()/Read() from another goroutine, which periodically outputs the process data store.
+// The process data store is used to store process data objects associated with an address. For each address, the most recent object is stored.
+// Optionally, the most recent objects of an address are kept in a history, and addresses that stopped receiving updates are detected.
+// The most recent objects can be saved to a checkpoint file and restored from it, e.g. after a restart.
+// The number of updates for each address is also stored, as well as whether the data of the address changed since the last read.
+// The typical use case is to call Write() from one goroutine and Snapshot() from another goroutine, which periodically outputs the process data store.
 // The process data store is thread safe.
 package processdatastore
 
 import (
+	"bytes"
 	"fmt"
 	"sort"
 	"sync"
+	"time"
 )
 
+// ObjectStore is implemented by Store and FixedStore
+type ObjectStore interface {
+	Write(o Object)
+	Read(address uint32) (Object, int, error)
+	ReadWithChange(address uint32) (Object, int, bool, error)
+	List() []int
+	Snapshot() []SnapshotEntry
+	Peek() []SnapshotEntry
+	SetChangeFilter(address uint32, f *ChangeFilter)
+	SetHistoryDepth(address uint32, depth int)
+	SetDefaultHistoryDepth(depth int)
+	SetStaleTimeout(address uint32, timeout time.Duration)
+	SetDefaultStaleTimeout(timeout time.Duration)
+	Checkpoint(name string) error
+	Restore(name string) (int, error)
+}
+
 // StoreEntry is the process data store for a single address
 type StoreEntry struct {
 	RecentObject Object
 	numUpdates   int
+	changed      bool   // whether the data changed since the last read
+	reference    []byte // data at the last change
+	history      *ring[Object]
+	restored     bool          // whether RecentObject has been restored from a checkpoint
+	timeout      time.Duration // stale timeout of the address
+	staleness
+	timing
+}
+
+// SnapshotEntry is the state of a single address at the time of a Snapshot()
+type SnapshotEntry struct {
+	Object  Object // the most recent object
+	Updates int    // number of updates since the previous read
+	Changed bool   // whether the data changed since the previous read
+	// History holds the objects received since the previous read, oldest first, so its last object is Object.
+	// It holds at most the history depth of the address, see SetHistoryDepth(), so it is nil if no history is kept.
+	History []Object
+	// LastUpdate is the time when the most recent object has been written
+	LastUpdate time.Time
+	// Stale is set if the address did not receive an update within its stale timeout. It is set only once, until the address recovers.
+	Stale bool
+	// Recovered is set if the address received an update after it had been stale
+	Recovered bool
+	// Timing holds the statistics of the intervals between the object timestamps since the previous read
+	Timing TimingStats
+	// Restored is set if Object has been restored from a checkpoint and the address has not been updated since
+	Restored bool
 }
 
 // Store is the process data store
 type Store struct {
 	sync.RWMutex
-	entry map[uint32]*StoreEntry
+	entry     map[uint32]*StoreEntry
+	addresses []uint32      // addresses of all entries, sorted in ascending order
+	entries   []*StoreEntry // entries in the order of addresses, so that Snapshot() needs no map lookups
+	filters   map[uint32]*ChangeFilter
+	depth     int                      // default history depth
+	depths    map[uint32]int           // history depth per address
+	timeout   time.Duration            // default stale timeout
+	timeouts  map[uint32]time.Duration // stale timeout per address
 }
 
 // NewStore creates a new process data store
 func NewStore() *Store {
 	return &Store{
-		entry: make(map[uint32]*StoreEntry),
+		entry:    make(map[uint32]*StoreEntry),
+		filters:  make(map[uint32]*ChangeFilter),
+		depths:   make(map[uint32]int),
+		timeouts: make(map[uint32]time.Duration),
+	}
+}
+
+// SetChangeFilter sets the filter which decides whether the data of address counts as changed.
+// Without filter, any difference of the data is a change.
+func (s *Store) SetChangeFilter(address uint32, f *ChangeFilter) {
+	s.Lock()
+	defer s.Unlock()
+	s.filters[address] = f
+}
+
+// SetHistoryDepth sets the number of recent objects to keep for address, overriding the default history depth.
+// 0 disables the history of the address.
+func (s *Store) SetHistoryDepth(address uint32, depth int) {
+	s.Lock()
+	defer s.Unlock()
+	s.depths[address] = depth
+}
+
+// SetDefaultHistoryDepth sets the number of recent objects to keep for all addresses without their own history depth.
+// 0, the default, disables the history.
+func (s *Store) SetDefaultHistoryDepth(depth int) {
+	s.Lock()
+	defer s.Unlock()
+	s.depth = depth
+}
+
+// SetStaleTimeout sets the time after which address is reported as stale by Snapshot() if it did not receive an update,
+// overriding the default stale timeout. 0 disables the staleness detection of the address.
+func (s *Store) SetStaleTimeout(address uint32, timeout time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.timeouts[address] = timeout
+	if e, ok := s.entry[address]; ok {
+		e.timeout = timeout
+	}
+}
+
+// SetDefaultStaleTimeout sets the stale timeout of all addresses without their own stale timeout.
+// 0, the default, disables the staleness detection.
+func (s *Store) SetDefaultStaleTimeout(timeout time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.timeout = timeout
+	for address, e := range s.entry {
+		e.timeout = s.staleTimeout(address)
 	}
 }
 
+// staleTimeout returns the stale timeout of address
+func (s *Store) staleTimeout(address uint32) time.Duration {
+	if timeout, ok := s.timeouts[address]; ok {
+		return timeout
+	}
+	return s.timeout
+}
+
 // Write writes an object to the process data store
 func (s *Store) Write(o Object) {
 	s.Lock()
@@ -37,27 +149,186 @@ func (s *Store) Write(o Object) {
 
 	e, ok := s.entry[o.Address()]
 	if !ok {
-		e = &StoreEntry{}
+		e = &StoreEntry{timeout: s.staleTimeout(o.Address())}
 		s.entry[o.Address()] = e
+		s.insertAddress(o.Address(), e)
+	}
+	// the first update after a restore confirms the restored data, so it counts as change as well
+	if !ok || e.restored || s.dataChanged(o.Address(), e.reference, o.Data()) {
+		e.changed = true
+		// copy, the data of the object may be reused by the caller
+		e.reference = append(e.reference[:0], o.Data()...)
 	}
 	e.numUpdates++
 	e.RecentObject = o
+	e.restored = false
+	e.update(time.Now())
+	e.add(o.Timestamp())
+
+	depth, ok := s.depths[o.Address()]
+	if !ok {
+		depth = s.depth
+	}
+	if depth == 0 {
+		e.history = nil
+	} else {
+		if e.history == nil || len(e.history.buf) != depth {
+			e.history = newRing[Object](depth)
+		}
+		*e.history.next() = o
+	}
 }
 
 // Read reads the entry for the specified address from the process data store.
 // In addition, it returns the number of updates for the address since the last call to Read().
 // If the address has never got an update, an error is returned.
 func (s *Store) Read(address uint32) (Object, int, error) {
+	o, numUpdates, _, err := s.ReadWithChange(address)
+	return o, numUpdates, err
+}
+
+// ReadWithChange reads the entry for the specified address like Read().
+// In addition, it returns whether the data of the address changed since the last call to Read() or ReadWithChange().
+// The data has changed if any update had other data than the data at the previous change, see SetChangeFilter().
+// So a change and its reversal between two reads is reported as well.
+// The first update of an address is always reported as change.
+func (s *Store) ReadWithChange(address uint32) (Object, int, bool, error) {
 	s.Lock()
 	defer s.Unlock()
 
 	e, ok := s.entry[address]
 	if !ok {
-		return nil, 0, fmt.Errorf("no entries for address %d", address)
+		return nil, 0, false, fmt.Errorf("no entries for address %d", address)
 	}
 	numUpdates := e.numUpdates
+	changed := e.changed
+	e.reset()
+	return e.RecentObject, numUpdates, changed, nil
+}
+
+// Snapshot returns all entries, sorted by address in ascending order, and resets their update counts and change flags,
+// as if Read() had been called for each address. In contrast to calling List() and Read(), all entries are taken at the same time
+// and the lock is taken only once.
+func (s *Store) Snapshot() []SnapshotEntry {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	snapshot := make([]SnapshotEntry, len(s.addresses))
+	for i, e := range s.entries {
+		// fill the entry in place, copying a complete SnapshotEntry is expensive for large stores
+		se := &snapshot[i]
+		se.Object = e.RecentObject
+		se.Updates = e.numUpdates
+		se.Changed = e.changed
+		se.LastUpdate = e.lastUpdate
+		if e.checked(e.timeout) {
+			se.Stale, se.Recovered = e.check(now, e.timeout)
+		}
+		if e.n > 0 {
+			se.Timing = e.take()
+		}
+		se.Restored = e.restored
+		if e.history != nil && e.history.len() > 0 {
+			se.History = make([]Object, e.history.len())
+			for j := range se.History {
+				se.History[j] = *e.history.at(j)
+			}
+		}
+		e.reset()
+	}
+	return snapshot
+}
+
+// reset starts a new read period
+func (e *StoreEntry) reset() {
 	e.numUpdates = 0
-	return e.RecentObject, numUpdates, nil
+	e.changed = false
+	e.clear()
+	if e.history != nil {
+		e.history.reset()
+	}
+}
+
+// Peek returns all entries, sorted by address in ascending order, like Snapshot(), but does not start a new read period:
+// The update counts, change flags, timing statistics and staleness are left untouched for the next Snapshot().
+// Therefore, the entries have no History, Timing, Stale and Recovered.
+func (s *Store) Peek() []SnapshotEntry {
+	s.RLock()
+	defer s.RUnlock()
+
+	entries := make([]SnapshotEntry, len(s.entries))
+	for i, e := range s.entries {
+		se := &entries[i]
+		se.Object = e.RecentObject
+		se.Updates = e.numUpdates
+		se.Changed = e.changed
+		se.LastUpdate = e.lastUpdate
+		se.Restored = e.restored
+	}
+	return entries
+}
+
+// Checkpoint saves the most recent object of each address to the file name, so that it can be restored with Restore()
+func (s *Store) Checkpoint(name string) error {
+	s.Lock()
+	entries := make([]checkpointEntry, len(s.addresses))
+	for i, address := range s.addresses {
+		entries[i] = newCheckpointEntry(s.entry[address].RecentObject)
+	}
+	s.Unlock()
+
+	return writeCheckpoint(name, entries)
+}
+
+// Restore loads the objects from the checkpoint file name into the store and returns the number of restored objects.
+// Only addresses that have not received any update yet are restored. They are reported as Restored by Snapshot() until their next update.
+// Restored objects do not count as update or change.
+func (s *Store) Restore(name string) (int, error) {
+	objects, err := readCheckpoint(name)
+	if err != nil {
+		return 0, err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, o := range objects {
+		if _, ok := s.entry[o.address]; ok {
+			continue
+		}
+		e := &StoreEntry{
+			RecentObject: o,
+			reference:    o.data,
+			restored:     true,
+			timeout:      s.staleTimeout(o.address),
+		}
+		e.lastUpdate = now
+		s.entry[o.address] = e
+		s.insertAddress(o.address, e)
+		n++
+	}
+	return n, nil
+}
+
+// insertAddress inserts a new address and its entry into the sorted address list
+func (s *Store) insertAddress(address uint32, e *StoreEntry) {
+	i := sort.Search(len(s.addresses), func(i int) bool { return s.addresses[i] >= address })
+	s.addresses = append(s.addresses, 0)
+	copy(s.addresses[i+1:], s.addresses[i:])
+	s.addresses[i] = address
+	s.entries = append(s.entries, nil)
+	copy(s.entries[i+1:], s.entries[i:])
+	s.entries[i] = e
+}
+
+// dataChanged checks whether data of address differs from reference, the data at the last change
+func (s *Store) dataChanged(address uint32, reference []byte, data []byte) bool {
+	if f, ok := s.filters[address]; ok {
+		return f.Changed(reference, data)
+	}
+	return !bytes.Equal(reference, data)
 }
 
 // List returns a list of all addresses in the process data store which have received any updates since the store creation.
@@ -66,11 +337,9 @@ func (s *Store) List() []int {
 	s.Lock()
 	defer s.Unlock()
 
-	keys := make([]int, 0, len(s.entry))
-	for k := range s.entry {
-		keys = append(keys, int(k))
+	keys := make([]int, len(s.addresses))
+	for i, address := range s.addresses {
+		keys[i] = int(address)
 	}
-	sort.Ints(keys)
-
 	return keys
 }
@@ -1,7 +1,10 @@
 package processdatastore_test
 
 import (
+	"fmt"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ci4rail/velog/pkg/processdatastore"
 
@@ -80,3 +83,288 @@ func TestStore(t *testing.T) {
 	assert.Equal(t, 457, list[1])
 	assert.Equal(t, 458, list[2])
 }
+
+func TestStoreChange(t *testing.T) {
+	s := processdatastore.NewStore()
+
+	// first update is a change
+	s.Write(newMyObject(123, 456, []byte{1, 2, 3}))
+	_, updates, changed, err := s.ReadWithChange(456)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updates)
+	assert.True(t, changed)
+
+	// updates with same data
+	s.Write(newMyObject(124, 456, []byte{1, 2, 3}))
+	s.Write(newMyObject(125, 456, []byte{1, 2, 3}))
+	_, updates, changed, err = s.ReadWithChange(456)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updates)
+	assert.False(t, changed)
+
+	// change and reversal
+	s.Write(newMyObject(126, 456, []byte{1, 2, 4}))
+	s.Write(newMyObject(127, 456, []byte{1, 2, 3}))
+	_, _, changed, err = s.ReadWithChange(456)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	// Read resets the change as well
+	s.Write(newMyObject(128, 456, []byte{1, 2, 5}))
+	s.Read(456)
+	_, updates, changed, err = s.ReadWithChange(456)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updates)
+	assert.False(t, changed)
+}
+
+func TestSnapshot(t *testing.T) {
+	s := processdatastore.NewStore()
+	assert.Empty(t, s.Snapshot())
+
+	s.Write(newMyObject(123, 458, []byte{1}))
+	s.Write(newMyObject(124, 456, []byte{2}))
+	s.Write(newMyObject(125, 456, []byte{2}))
+	s.Write(newMyObject(126, 457, []byte{3}))
+
+	snapshot := s.Snapshot()
+	assert.Equal(t, 3, len(snapshot))
+	assert.Equal(t, uint32(456), snapshot[0].Object.Address())
+	assert.Equal(t, 2, snapshot[0].Updates)
+	assert.True(t, snapshot[0].Changed)
+	assert.Equal(t, uint32(457), snapshot[1].Object.Address())
+	assert.Equal(t, uint32(458), snapshot[2].Object.Address())
+	assert.Equal(t, []int{456, 457, 458}, s.List())
+
+	// counters have been reset
+	s.Write(newMyObject(127, 457, []byte{3}))
+	snapshot = s.Snapshot()
+	assert.Equal(t, 0, snapshot[0].Updates)
+	assert.False(t, snapshot[0].Changed)
+	assert.Equal(t, 1, snapshot[1].Updates)
+	assert.False(t, snapshot[1].Changed)
+	assert.Equal(t, int64(127), snapshot[1].Object.Timestamp())
+
+	// same as Read()
+	_, updates, err := s.Read(457)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updates)
+}
+
+// benchmarkStore creates a store with n addresses
+func benchmarkStore(n int) *processdatastore.Store {
+	s := processdatastore.NewStore()
+	for a := 0; a < n; a++ {
+		s.Write(newMyObject(int64(a), uint32(a), []byte{1, 2, 3, 4}))
+	}
+	return s
+}
+
+func BenchmarkDumpListRead(b *testing.B) {
+	for _, n := range []int{256, 4096} {
+		b.Run(fmt.Sprintf("addresses=%d", n), func(b *testing.B) {
+			s := benchmarkStore(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, address := range s.List() {
+					s.ReadWithChange(uint32(address))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDumpSnapshot(b *testing.B) {
+	for _, n := range []int{256, 4096} {
+		b.Run(fmt.Sprintf("addresses=%d", n), func(b *testing.B) {
+			s := benchmarkStore(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Snapshot()
+			}
+		})
+	}
+}
+
+func testHistory(t *testing.T, s processdatastore.ObjectStore) {
+	s.SetDefaultHistoryDepth(2)
+	s.SetHistoryDepth(457, 0)
+	s.SetHistoryDepth(458, 3)
+
+	for i := 0; i < 4; i++ {
+		s.Write(newMyObject(int64(100+i), 456, []byte{byte(i)}))
+		s.Write(newMyObject(int64(200+i), 457, []byte{byte(i)}))
+		s.Write(newMyObject(int64(300+i), 458, []byte{byte(i)}))
+	}
+
+	snapshot := s.Snapshot()
+	assert.Equal(t, 3, len(snapshot))
+	// default depth, the oldest objects are dropped
+	assert.Equal(t, 4, snapshot[0].Updates)
+	assert.Equal(t, 2, len(snapshot[0].History))
+	assert.Equal(t, int64(102), snapshot[0].History[0].Timestamp())
+	assert.Equal(t, []byte{2}, snapshot[0].History[0].Data())
+	assert.Equal(t, int64(103), snapshot[0].History[1].Timestamp())
+	// no history
+	assert.Nil(t, snapshot[1].History)
+	// own depth
+	assert.Equal(t, 3, len(snapshot[2].History))
+	assert.Equal(t, int64(301), snapshot[2].History[0].Timestamp())
+	assert.Equal(t, snapshot[2].Object.Timestamp(), snapshot[2].History[2].Timestamp())
+
+	// history starts again after each read
+	s.Write(newMyObject(104, 456, []byte{4}))
+	s.Read(458)
+	snapshot = s.Snapshot()
+	assert.Equal(t, 1, len(snapshot[0].History))
+	assert.Equal(t, int64(104), snapshot[0].History[0].Timestamp())
+	assert.Nil(t, snapshot[2].History)
+}
+
+func testStale(t *testing.T, s processdatastore.ObjectStore) {
+	s.SetDefaultStaleTimeout(20 * time.Millisecond)
+	s.SetStaleTimeout(457, 0)
+
+	before := time.Now()
+	s.Write(newMyObject(100, 456, []byte{1}))
+	s.Write(newMyObject(200, 457, []byte{1}))
+
+	snapshot := s.Snapshot()
+	assert.False(t, snapshot[0].Stale)
+	assert.False(t, snapshot[0].Recovered)
+	assert.False(t, snapshot[0].LastUpdate.Before(before))
+
+	time.Sleep(50 * time.Millisecond)
+	snapshot = s.Snapshot()
+	assert.True(t, snapshot[0].Stale)
+	assert.Equal(t, int64(100), snapshot[0].Object.Timestamp())
+	// no timeout
+	assert.False(t, snapshot[1].Stale)
+
+	// reported only once
+	snapshot = s.Snapshot()
+	assert.False(t, snapshot[0].Stale)
+
+	s.Write(newMyObject(101, 456, []byte{1}))
+	snapshot = s.Snapshot()
+	assert.False(t, snapshot[0].Stale)
+	assert.True(t, snapshot[0].Recovered)
+
+	snapshot = s.Snapshot()
+	assert.False(t, snapshot[0].Recovered)
+}
+
+func testTiming(t *testing.T, s processdatastore.ObjectStore) {
+	// intervals 1000, 3000, 2000us
+	for _, ts := range []int64{10000, 11000, 14000, 16000} {
+		s.Write(newMyObject(ts, 456, []byte{1}))
+	}
+	s.Write(newMyObject(500, 457, []byte{1}))
+
+	snapshot := s.Snapshot()
+	timing := snapshot[0].Timing
+	assert.Equal(t, 3, timing.Intervals)
+	assert.Equal(t, 2000*time.Microsecond, timing.Mean)
+	assert.Equal(t, 1000*time.Microsecond, timing.Min)
+	assert.Equal(t, 3000*time.Microsecond, timing.Max)
+	assert.InDelta(t, float64(816*time.Microsecond), float64(timing.Jitter), float64(time.Microsecond))
+	// a single update has no interval
+	assert.Equal(t, 0, snapshot[1].Timing.Intervals)
+
+	// the interval to the last update of the previous period is included
+	s.Write(newMyObject(16500, 456, []byte{1}))
+	snapshot = s.Snapshot()
+	timing = snapshot[0].Timing
+	assert.Equal(t, 1, timing.Intervals)
+	assert.Equal(t, 500*time.Microsecond, timing.Mean)
+	assert.Equal(t, time.Duration(0), timing.Jitter)
+
+	// no update
+	snapshot = s.Snapshot()
+	assert.Equal(t, processdatastore.TimingStats{}, snapshot[0].Timing)
+}
+
+func TestStoreTiming(t *testing.T) {
+	testTiming(t, processdatastore.NewStore())
+}
+
+func testCheckpoint(t *testing.T, newStore func() processdatastore.ObjectStore) {
+	name := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	s := newStore()
+	s.Write(newMyObject(100, 456, []byte{1, 2}))
+	s.Write(newMyObject(200, 457, []byte{3}))
+	assert.NoError(t, s.Checkpoint(name))
+
+	s = newStore()
+	_, err := s.Restore(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+
+	s.Write(newMyObject(300, 457, []byte{4}))
+	n, err := s.Restore(name)
+	assert.NoError(t, err)
+	// 457 has already been updated
+	assert.Equal(t, 1, n)
+
+	snapshot := s.Snapshot()
+	assert.Equal(t, 2, len(snapshot))
+	assert.True(t, snapshot[0].Restored)
+	assert.Equal(t, 0, snapshot[0].Updates)
+	assert.False(t, snapshot[0].Changed)
+	assert.Equal(t, uint32(456), snapshot[0].Object.Address())
+	assert.Equal(t, int64(100), snapshot[0].Object.Timestamp())
+	assert.Equal(t, []byte{1, 2}, snapshot[0].Object.Data())
+	assert.False(t, snapshot[1].Restored)
+	assert.Equal(t, []byte{4}, snapshot[1].Object.Data())
+
+	// restored until the next update, which counts as change
+	snapshot = s.Snapshot()
+	assert.True(t, snapshot[0].Restored)
+	s.Write(newMyObject(400, 456, []byte{1, 2}))
+	snapshot = s.Snapshot()
+	assert.False(t, snapshot[0].Restored)
+	assert.True(t, snapshot[0].Changed)
+}
+
+func TestStoreCheckpoint(t *testing.T) {
+	testCheckpoint(t, func() processdatastore.ObjectStore { return processdatastore.NewStore() })
+}
+
+func TestStoreStale(t *testing.T) {
+	testStale(t, processdatastore.NewStore())
+}
+
+func TestStoreHistory(t *testing.T) {
+	testHistory(t, processdatastore.NewStore())
+}
+
+func testPeek(t *testing.T, s processdatastore.ObjectStore) {
+	s.Write(newMyObject(100, 456, []byte{1}))
+	s.Write(newMyObject(200, 456, []byte{2}))
+	s.Write(newMyObject(300, 457, []byte{3}))
+	s.Snapshot()
+	s.Write(newMyObject(400, 457, []byte{4}))
+
+	// peek does not start a new read period
+	for i := 0; i < 2; i++ {
+		entries := s.Peek()
+		assert.Equal(t, 2, len(entries))
+		assert.Equal(t, uint32(456), entries[0].Object.Address())
+		assert.Equal(t, []byte{2}, entries[0].Object.Data())
+		assert.Equal(t, 0, entries[0].Updates)
+		assert.False(t, entries[0].Changed)
+		assert.Equal(t, []byte{4}, entries[1].Object.Data())
+		assert.Equal(t, 1, entries[1].Updates)
+		assert.True(t, entries[1].Changed)
+	}
+
+	snapshot := s.Snapshot()
+	assert.Equal(t, 0, snapshot[0].Updates)
+	assert.Equal(t, 1, snapshot[1].Updates)
+	assert.True(t, snapshot[1].Changed)
+	assert.Equal(t, 1, snapshot[1].Timing.Intervals)
+}
+
+func TestStorePeek(t *testing.T) {
+	testPeek(t, processdatastore.NewStore())
+}
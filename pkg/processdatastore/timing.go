@@ -0,0 +1,75 @@
+package processdatastore
+
+import (
+	"math"
+	"time"
+)
+
+// TimingStats holds the statistics of the intervals between the updates of an address, based on the object timestamps
+type TimingStats struct {
+	Intervals int           // number of intervals, 0 if there were less than two updates
+	Mean      time.Duration // mean interval, i.e. the update period
+	Min       time.Duration // shortest interval
+	Max       time.Duration // longest interval
+	Jitter    time.Duration // standard deviation of the intervals
+}
+
+// timing accumulates the intervals between the object timestamps of an address.
+// The interval to the last object of the previous read period is included.
+type timing struct {
+	lastTimestamp int64 // timestamp of the previous object in microseconds
+	hasLast       bool
+	n             int
+	sum           int64
+	sumSq         float64
+	min           int64
+	max           int64
+}
+
+// add adds the object timestamp ts in microseconds
+func (t *timing) add(ts int64) {
+	if t.hasLast && ts >= t.lastTimestamp {
+		d := ts - t.lastTimestamp
+		if t.n == 0 || d < t.min {
+			t.min = d
+		}
+		if t.n == 0 || d > t.max {
+			t.max = d
+		}
+		t.n++
+		t.sum += d
+		t.sumSq += float64(d) * float64(d)
+	}
+	// timestamps going backwards, e.g. after a device restart, start over
+	t.lastTimestamp = ts
+	t.hasLast = true
+}
+
+// take returns the statistics since the previous call and resets them
+func (t *timing) take() TimingStats {
+	if t.n == 0 {
+		return TimingStats{}
+	}
+	mean := float64(t.sum) / float64(t.n)
+	variance := t.sumSq/float64(t.n) - mean*mean
+	if variance < 0 {
+		// rounding
+		variance = 0
+	}
+	stats := TimingStats{
+		Intervals: t.n,
+		Mean:      time.Duration(mean * float64(time.Microsecond)),
+		Min:       time.Duration(t.min) * time.Microsecond,
+		Max:       time.Duration(t.max) * time.Microsecond,
+		Jitter:    time.Duration(math.Sqrt(variance) * float64(time.Microsecond)),
+	}
+	t.clear()
+	return stats
+}
+
+// clear discards the statistics since the previous call to take
+func (t *timing) clear() {
+	t.n = 0
+	t.sum = 0
+	t.sumSq = 0
+}